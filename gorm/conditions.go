@@ -1,62 +1,210 @@
 package gorm
 
-import "gorm.io/gorm"
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// CondType 是条件的连接方式
+type CondType int
+
+const (
+	// CondAnd 以AND连接
+	CondAnd CondType = iota
+	// CondOr 以OR连接
+	CondOr
+	// CondNot 以AND NOT连接
+	CondNot
+)
+
+// Cond 是一个查询条件，Query可以是字符串或clause.Expression
+type Cond struct {
+	Type  CondType
+	Query interface{}
+	Args  []interface{}
+}
 
 // DBConditions DB常用的查询条件封装
 type DBConditions struct {
-	And       map[string]interface{}
-	Or        map[string]interface{}
-	Not       map[string]interface{}
-	Limit     int
-	Offset    int
+	// And/Or/Not 按key排序后添加，保证生成的SQL一致；需要指定顺序时使用Conds
+	And    map[string]interface{}
+	Or     map[string]interface{}
+	Not    map[string]interface{}
+	Conds  []Cond
+	Limit  int
+	Offset int
+	// Page/PageSize 大于0时覆盖Limit及Offset，Page从1开始
+	Page      int
+	PageSize  int
 	Order     interface{}
 	Select    interface{}
 	Group     string
 	Having    interface{}
 	NeedCount bool
 	Count     int64
-	Distinct  interface{} // grom v1 暂不支持
+	Distinct  interface{}
+}
+
+// Where 按顺序添加AND条件
+func (d *DBConditions) Where(query interface{}, args ...interface{}) *DBConditions {
+	d.Conds = append(d.Conds, Cond{Type: CondAnd, Query: query, Args: args})
+	return d
 }
 
-// Fill 填充查询条件
+// OrWhere 按顺序添加OR条件
+func (d *DBConditions) OrWhere(query interface{}, args ...interface{}) *DBConditions {
+	d.Conds = append(d.Conds, Cond{Type: CondOr, Query: query, Args: args})
+	return d
+}
+
+// NotWhere 按顺序添加NOT条件
+func (d *DBConditions) NotWhere(query interface{}, args ...interface{}) *DBConditions {
+	d.Conds = append(d.Conds, Cond{Type: CondNot, Query: query, Args: args})
+	return d
+}
+
+// Paginate 设置页码及每页条数，page从1开始
+func (d *DBConditions) Paginate(page, pageSize int) *DBConditions {
+	d.Page, d.PageSize = page, pageSize
+	return d
+}
+
+// Pages 返回按PageSize计算的总页数，需要NeedCount
+func (d *DBConditions) Pages() int {
+	if d.PageSize <= 0 {
+		return 0
+	}
+
+	return int((d.Count + int64(d.PageSize) - 1) / int64(d.PageSize))
+}
+
+// Fill 填充查询条件，NeedCount时按 WHERE、GROUP BY、HAVING 统计总数（有分组时统计分组数），
+// 不受 ORDER BY、LIMIT 影响；统计总数需要在调用Fill之前设置Table或Model
 func (d *DBConditions) Fill(db *gorm.DB) *gorm.DB {
+	if d.NeedCount {
+		if err := d.count(db); err != nil {
+			_ = db.AddError(err) //nolint:errcheck
+		}
+	}
+
 	if d.Select != nil {
 		db = db.Select(d.Select)
 	}
+	if d.Distinct != nil {
+		db = db.Distinct(d.Distinct)
+	}
+	db = d.filter(db)
 
-	for cond, val := range d.And {
-		db = db.Where(cond, val)
+	if d.Order != nil {
+		db = db.Order(d.Order)
+	}
+	limit, offset := d.Limit, d.Offset
+	if d.Page > 0 && d.PageSize > 0 {
+		limit, offset = d.PageSize, (d.Page-1)*d.PageSize
 	}
-	for cond, val := range d.Not {
-		db = db.Not(cond, val)
+	if limit != 0 {
+		db = db.Limit(limit)
 	}
-	for cond, val := range d.Or {
-		db = db.Or(cond, val)
+	if offset != 0 {
+		db = db.Offset(offset)
 	}
 
-	if d.NeedCount {
-		db = db.Count(&d.Count)
+	return db
+}
+
+// filter 添加条件、分组及分组条件
+func (d *DBConditions) filter(db *gorm.DB) *gorm.DB {
+	for _, cond := range sortedConds(d.And) {
+		db = db.Where(cond, d.And[cond])
 	}
-	if d.Order != nil {
-		db = db.Order(d.Order)
+	for _, cond := range sortedConds(d.Not) {
+		db = db.Not(cond, d.Not[cond])
 	}
-	if d.Limit != 0 {
-		db = db.Limit(d.Limit)
+	for _, cond := range sortedConds(d.Or) {
+		db = db.Or(cond, d.Or[cond])
 	}
-	if d.Offset != 0 {
-		db = db.Offset(d.Offset)
+	for _, cond := range d.Conds {
+		switch cond.Type {
+		case CondOr:
+			db = db.Or(cond.Query, cond.Args...)
+		case CondNot:
+			db = db.Not(cond.Query, cond.Args...)
+		default:
+			db = db.Where(cond.Query, cond.Args...)
+		}
 	}
+
 	if d.Group != "" {
 		db = db.Group(d.Group)
 	}
 	if d.Having != nil {
 		db = db.Having(d.Having)
 	}
+
+	return db
+}
+
+// count 统计总数，有分组时统计子查询的行数
+func (d *DBConditions) count(db *gorm.DB) error {
+	tx := db.Session(&gorm.Session{})
 	if d.Distinct != nil {
-		db = db.Distinct(d.Distinct)
+		tx = tx.Distinct(d.Distinct)
 	}
+	tx = d.filter(tx)
 
-	return db
+	if d.Group == "" && d.Having == nil {
+		return tx.Count(&d.Count).Error
+	}
+
+	if d.Distinct == nil {
+		switch {
+		case d.Select != nil:
+			tx = tx.Select(d.Select)
+		case d.Group != "":
+			tx = tx.Select(d.Group)
+		default:
+			tx = tx.Select("1")
+		}
+	}
+
+	return db.Session(&gorm.Session{NewDB: true}).Table("(?) AS count_t", tx).Count(&d.Count).Error
+}
+
+func sortedConds(conds map[string]interface{}) []string {
+	keys := make([]string, 0, len(conds))
+	for cond := range conds {
+		keys = append(keys, cond)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// PageResult 是分页查询的结果
+type PageResult[T any] struct {
+	Items    []T   `json:"items"`
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+	Pages    int   `json:"pages"`
+}
+
+// Paginate 按cond查询一页数据及总数，db需要已设置Table或Model
+func Paginate[T any](db *gorm.DB, cond *DBConditions) (*PageResult[T], error) {
+	cond.NeedCount = true
+	items := make([]T, 0)
+	if err := cond.Fill(db).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	return &PageResult[T]{
+		Items:    items,
+		Total:    cond.Count,
+		Page:     cond.Page,
+		PageSize: cond.PageSize,
+		Pages:    cond.Pages(),
+	}, nil
 }
 
 /* demo
@@ -71,4 +219,5 @@ cond := &base.DBConditions{
 	Offset: 1,
 	Order: "id DESC",
 }
+cond.Where("status = ?", 1).OrWhere("vip = ?", true).Paginate(2, 20)
 */
@@ -0,0 +1,180 @@
+package gorm
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type condRecord struct {
+	ID   int
+	Name string
+	Age  int
+	Team string
+	Note *string
+}
+
+func (condRecord) TableName() string {
+	return "cond_record"
+}
+
+func newCondEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	db := newTestEngine(t, sqliteConfig(t, "cond.db"), &condRecord{})
+
+	note := "vip"
+	require.NoError(t, db.Context(ctx).Create([]*condRecord{
+		{ID: 1, Name: "tom", Age: 18, Team: "a"},
+		{ID: 2, Name: "jerry", Age: 20, Team: "a", Note: &note},
+		{ID: 3, Name: "spike", Age: 30, Team: "b"},
+		{ID: 4, Name: "tyke", Age: 5, Team: "b"},
+		{ID: 5, Name: "50%_off", Age: 40, Team: "c"},
+	}).Error)
+
+	return db
+}
+
+func TestConditionsDeterministic(t *testing.T) {
+	db := newCondEngine(t)
+
+	build := func() string {
+		return db.GetDB().ToSQL(func(tx *gorm.DB) *gorm.DB {
+			cond := &DBConditions{
+				And: map[string]interface{}{"name = ?": "tom", "age > ?": 1, "team = ?": "a", "id > ?": 0},
+				Or:  map[string]interface{}{"id = ?": 3, "age < ?": 10},
+			}
+			cond.Where("note IS NULL").NotWhere("id = ?", 9)
+			var records []condRecord
+			return cond.Fill(tx.Model(&condRecord{})).Find(&records)
+		})
+	}
+
+	sql := build()
+	for i := 0; i < 20; i++ {
+		require.Equal(t, sql, build())
+	}
+	require.Contains(t, sql, "WHERE age > 1 AND id > 0 AND name = \"tom\" AND team = \"a\" OR age < 10 OR id = 3 AND note IS NULL AND NOT id = 9")
+}
+
+func TestConditionsCount(t *testing.T) {
+	db := newCondEngine(t)
+
+	// 总数不受排序及分页影响
+	cond := &DBConditions{NeedCount: true, Order: "id DESC", Limit: 2, Offset: 1}
+	cond.Where("age >= ?", 10)
+	var records []condRecord
+	require.NoError(t, cond.Fill(db.Context(ctx).Model(&condRecord{})).Find(&records).Error)
+	require.Equal(t, int64(4), cond.Count)
+	require.Len(t, records, 2)
+	require.Equal(t, 3, records[0].ID)
+
+	// 分组时统计分组数
+	type teamCount struct {
+		Team  string
+		Total int
+	}
+	cond = &DBConditions{NeedCount: true, Select: "team, COUNT(*) AS total", Group: "team", Having: "COUNT(*) > 1", Limit: 1}
+	var teams []teamCount
+	require.NoError(t, cond.Fill(db.Context(ctx).Model(&condRecord{})).Find(&teams).Error)
+	require.Equal(t, int64(2), cond.Count)
+	require.Len(t, teams, 1)
+
+	cond = &DBConditions{NeedCount: true, Group: "team"}
+	require.NoError(t, cond.Fill(db.Context(ctx).Model(&condRecord{})).Select("team").Find(&teams).Error)
+	require.Equal(t, int64(3), cond.Count)
+
+	// 统计出错时错误会返回
+	cond = &DBConditions{NeedCount: true}
+	cond.Where("missing = ?", 1)
+	require.Error(t, cond.Fill(db.Context(ctx).Model(&condRecord{})).Find(&records).Error)
+}
+
+func TestPaginate(t *testing.T) {
+	db := newCondEngine(t)
+
+	cond := (&DBConditions{Order: "id"}).Paginate(2, 2)
+	page, err := Paginate[condRecord](db.Context(ctx).Model(&condRecord{}), cond)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), page.Total)
+	require.Equal(t, 3, page.Pages)
+	require.Equal(t, 2, page.Page)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, 3, page.Items[0].ID)
+
+	cond = (&DBConditions{}).Paginate(9, 2)
+	page, err = Paginate[condRecord](db.Context(ctx).Model(&condRecord{}), cond)
+	require.NoError(t, err)
+	require.Empty(t, page.Items)
+	require.NotNil(t, page.Items)
+}
+
+func TestConditionsFromQuery(t *testing.T) {
+	db := newCondEngine(t)
+	spec := QuerySpec{
+		Filters:     map[string]string{"name": "name", "age": "age", "team": "team", "note": "note"},
+		Sorts:       map[string]string{"age": "age", "id": "id"},
+		DefaultSort: "id",
+		MaxPageSize: 3,
+	}
+
+	find := func(query string) ([]int, *DBConditions) {
+		values, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		cond, err := ConditionsFromQuery(values, spec)
+		require.NoError(t, err, query)
+
+		page, err := Paginate[condRecord](db.Context(ctx).Model(&condRecord{}), cond)
+		require.NoError(t, err, query)
+		ids := make([]int, 0, len(page.Items))
+		for _, r := range page.Items {
+			ids = append(ids, r.ID)
+		}
+
+		return ids, cond
+	}
+
+	ids, cond := find("age__gte=10&team__in=a,b&sort=-age&token=ignored")
+	require.Equal(t, []int{3, 2, 1}, ids)
+	require.Equal(t, int64(3), cond.Count)
+
+	ids, _ = find("team__nin=a&age__lt=35")
+	require.Equal(t, []int{3, 4}, ids)
+
+	ids, _ = find("note__isnull=false")
+	require.Equal(t, []int{2}, ids)
+
+	// LIKE的通配符会被转义
+	ids, _ = find("name__like=%25_")
+	require.Equal(t, []int{5}, ids)
+	ids, _ = find("name__like=er")
+	require.Equal(t, []int{2}, ids)
+
+	// page_size不超过上限
+	ids, cond = find("page=2&page_size=50")
+	require.Equal(t, []int{4, 5}, ids)
+	require.Equal(t, 3, cond.PageSize)
+
+	for _, query := range []string{
+		"age__between=1",
+		"sort=name",
+		"page=0",
+		"page_size=x",
+		"note__isnull=maybe",
+	} {
+		values, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		_, err = ConditionsFromQuery(values, spec)
+		require.True(t, errors.Is(err, ErrInvalidQuery), query)
+	}
+
+	// 不在白名单中的字段不会生成条件
+	values := url.Values{"id": {"1"}, "name__xx": {"1"}}
+	_, err := ConditionsFromQuery(url.Values{"password": {"x"}}, spec)
+	require.NoError(t, err)
+	_, err = ConditionsFromQuery(values, spec)
+	require.True(t, errors.Is(err, ErrInvalidQuery))
+}
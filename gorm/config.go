@@ -9,18 +9,47 @@ import (
 
 // Config 是gorm的配置文件字段定义
 type Config struct {
-	Alias        string        `mapstructure:"alias" json:"alias" yaml:"alias" comment:"数据库别名"`
-	Driver       string        `mapstructure:"driver" json:"driver" yaml:"driver" comment:"数据库驱动"`
-	Server       string        `mapstructure:"server" json:"server" yaml:"server" comment:"数据库服务器地址"`
-	Port         int           `mapstructure:"port" json:"port" yaml:"port" comment:"数据库端口"`
-	Database     string        `mapstructure:"database" json:"database" yaml:"database" comment:"数据库名称"`
-	User         string        `mapstructure:"user" json:"user" yaml:"user" comment:"数据库用户名"`
-	Password     string        `mapstructure:"password" json:"password" yaml:"password" comment:"数据库密码"`
-	MaxIdleConns int           `mapstructure:"maxIdleConns" json:"maxIdleConns" yaml:"maxIdleConns" comment:"最大空闲连接数"`
-	MaxOpenConns int           `mapstructure:"maxOpenConns" json:"maxOpenConns" yaml:"maxOpenConns" comment:"最大打开连接数"`
-	Charset      string        `mapstructure:"charset" json:"charset" yaml:"charset" comment:"字符集"`
-	TimeZone     string        `mapstructure:"timezone" json:"timezone" yaml:"timezone" comment:"时区"`
-	MaxLeftTime  time.Duration `mapstructure:"maxLeftTime" json:"maxLeftTime" yaml:"maxLeftTime" comment:"最大连接时间 0h20m30s"`
+	Alias                   string            `mapstructure:"alias" json:"alias" yaml:"alias" comment:"数据库别名"`
+	Driver                  string            `mapstructure:"driver" json:"driver" yaml:"driver" comment:"数据库驱动"`
+	Server                  string            `mapstructure:"server" json:"server" yaml:"server" comment:"数据库服务器地址"`
+	Port                    int               `mapstructure:"port" json:"port" yaml:"port" comment:"数据库端口"`
+	Database                string            `mapstructure:"database" json:"database" yaml:"database" comment:"数据库名称"`
+	User                    string            `mapstructure:"user" json:"user" yaml:"user" comment:"数据库用户名"`
+	Password                string            `mapstructure:"password" json:"password" yaml:"password" comment:"数据库密码"`
+	MaxIdleConns            int               `mapstructure:"maxIdleConns" json:"maxIdleConns" yaml:"maxIdleConns" comment:"最大空闲连接数"`
+	MaxOpenConns            int               `mapstructure:"maxOpenConns" json:"maxOpenConns" yaml:"maxOpenConns" comment:"最大打开连接数"`
+	Charset                 string            `mapstructure:"charset" json:"charset" yaml:"charset" comment:"字符集"`
+	TimeZone                string            `mapstructure:"timezone" json:"timezone" yaml:"timezone" comment:"时区"`
+	MaxLeftTime             time.Duration     `mapstructure:"maxLeftTime" json:"maxLeftTime" yaml:"maxLeftTime" comment:"最大连接时间 0h20m30s"`
+	Replicas                []Replica         `mapstructure:"replicas" json:"replicas" yaml:"replicas" comment:"从库列表"`
+	ReplicaPolicy           string            `mapstructure:"replicaPolicy" json:"replicaPolicy" yaml:"replicaPolicy" comment:"从库选择策略 round_robin random"`
+	ConnectRetries          int               `mapstructure:"connectRetries" json:"connectRetries" yaml:"connectRetries" comment:"启动时连接失败的重试次数"`
+	ConnectRetryInterval    time.Duration     `mapstructure:"connectRetryInterval" json:"connectRetryInterval" yaml:"connectRetryInterval" comment:"首次重试的间隔，之后每次翻倍，默认1s"`
+	ConnectRetryMaxInterval time.Duration     `mapstructure:"connectRetryMaxInterval" json:"connectRetryMaxInterval" yaml:"connectRetryMaxInterval" comment:"重试的最大间隔，默认30s"`
+	PingInterval            time.Duration     `mapstructure:"pingInterval" json:"pingInterval" yaml:"pingInterval" comment:"后台ping的间隔，0为不开启"`
+	MetricsLogInterval      time.Duration     `mapstructure:"metricsLogInterval" json:"metricsLogInterval" yaml:"metricsLogInterval" comment:"定期输出统计日志的间隔，0为不开启"`
+	DSN                     string            `mapstructure:"dsn" json:"dsn" yaml:"dsn" comment:"直接指定DSN，设置后忽略其他连接参数"`
+	SSLMode                 string            `mapstructure:"sslMode" json:"sslMode" yaml:"sslMode" comment:"postgres的sslmode disable require verify-ca verify-full"`
+	TLS                     string            `mapstructure:"tls" json:"tls" yaml:"tls" comment:"mysql的tls参数 true skip-verify 或注册的配置名，clickhouse非空时开启secure"`
+	DialTimeout             time.Duration     `mapstructure:"dialTimeout" json:"dialTimeout" yaml:"dialTimeout" comment:"建立连接的超时时间"`
+	ReadTimeout             time.Duration     `mapstructure:"readTimeout" json:"readTimeout" yaml:"readTimeout" comment:"读超时时间，mysql clickhouse有效"`
+	WriteTimeout            time.Duration     `mapstructure:"writeTimeout" json:"writeTimeout" yaml:"writeTimeout" comment:"写超时时间，mysql有效"`
+	Params                  map[string]string `mapstructure:"params" json:"params" yaml:"params" comment:"追加到DSN的额外参数"`
+	LogLevel                string            `mapstructure:"logLevel" json:"logLevel" yaml:"logLevel" comment:"SQL日志等级 silent error warn info，默认info"`
+	SlowThreshold           time.Duration     `mapstructure:"slowThreshold" json:"slowThreshold" yaml:"slowThreshold" comment:"慢查询阈值，默认200ms，负数为不记录慢查询"`
+	ParameterizedQueries    bool              `mapstructure:"parameterizedQueries" json:"parameterizedQueries" yaml:"parameterizedQueries" comment:"日志中的SQL不带参数值"`
+	LogRecordNotFound       bool              `mapstructure:"logRecordNotFound" json:"logRecordNotFound" yaml:"logRecordNotFound" comment:"记录未找到时输出error日志"`
+	TraceRedactVars         bool              `mapstructure:"traceRedactVars" json:"traceRedactVars" yaml:"traceRedactVars" comment:"span的db.statement中不带参数值"`
+}
+
+// Replica 是从库的配置，为空的字段与主库一致
+type Replica struct {
+	Server   string `mapstructure:"server" json:"server" yaml:"server" comment:"从库服务器地址"`
+	Port     int    `mapstructure:"port" json:"port" yaml:"port" comment:"从库端口"`
+	Database string `mapstructure:"database" json:"database" yaml:"database" comment:"从库数据库名称"`
+	User     string `mapstructure:"user" json:"user" yaml:"user" comment:"从库用户名"`
+	Password string `mapstructure:"password" json:"password" yaml:"password" comment:"从库密码"`
+	DSN      string `mapstructure:"dsn" json:"dsn" yaml:"dsn" comment:"直接指定从库的DSN"`
 }
 
 func authConfig(conf *Config) (err error) {
@@ -28,20 +57,13 @@ func authConfig(conf *Config) (err error) {
 		conf.Driver = defaultDatabase
 	}
 	if conf.Port == 0 {
-		conf.Port = defaultPort
-	}
-	if conf.Driver != "sqlite" && (len(conf.User) == 0 || len(conf.Password) == 0) {
-		err = errors.New("User or  Password is empty")
-		return
+		conf.Port = defaultPorts[conf.Driver]
 	}
-
-	if conf.Driver != "sqlite" && len(conf.Server) == 0 {
-		err = errors.New("server addr is empty")
-		return
-	}
-	if len(conf.Database) == 0 {
-		err = errors.New("database is empty")
-		return
+	// 直接配置了DSN或自定义的驱动不校验连接参数
+	if conf.DSN == "" && isBuiltinDriver(conf.Driver) {
+		if err = authConnConfig(conf); err != nil {
+			return
+		}
 	}
 	if conf.MaxIdleConns == 0 {
 		conf.MaxIdleConns = defaultMaxIdleConns
@@ -60,5 +82,37 @@ func authConfig(conf *Config) (err error) {
 		conf.TimeZone = defaultTimeZone
 	}
 
+	if _, err = ParseLogLevel(conf.LogLevel); err != nil {
+		return
+	}
+
+	switch conf.ReplicaPolicy {
+	case "":
+		conf.ReplicaPolicy = ReplicaPolicyRoundRobin
+	case ReplicaPolicyRoundRobin, ReplicaPolicyRandom:
+	default:
+		err = errors.Errorf("unknown replica policy %s", conf.ReplicaPolicy)
+		return
+	}
+
+	return
+}
+
+// authConnConfig 校验生成DSN所需的连接参数
+func authConnConfig(conf *Config) (err error) {
+	if conf.Driver != "sqlite" && (len(conf.User) == 0 || len(conf.Password) == 0) {
+		err = errors.New("User or  Password is empty")
+		return
+	}
+
+	if conf.Driver != "sqlite" && len(conf.Server) == 0 {
+		err = errors.New("server addr is empty")
+		return
+	}
+	if len(conf.Database) == 0 {
+		err = errors.New("database is empty")
+		return
+	}
+
 	return
 }
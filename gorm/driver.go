@@ -0,0 +1,116 @@
+package gorm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+/* 数据库驱动注册 */
+
+// DriverFunc 根据配置创建gorm的Dialector
+type DriverFunc func(conf *Config) (gorm.Dialector, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]DriverFunc{
+		"mysql":      mysqlDriver,
+		"postgres":   postgresDriver,
+		"clickhouse": clickhouseDriver,
+		"sqlite":     sqliteDriver,
+	}
+)
+
+// RegisterDriver 注册或替换驱动，Config.Driver为name时使用fn创建Dialector，
+// 可用于接入其他数据库或在测试中使用mock的Dialector
+func RegisterDriver(name string, fn DriverFunc) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	drivers[name] = fn
+}
+
+// Drivers 返回已注册的驱动名称
+func Drivers() []string {
+	driversMu.RLock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	driversMu.RUnlock()
+	sort.Strings(names)
+
+	return names
+}
+
+func lookupDriver(name string) (DriverFunc, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	fn, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, name)
+	}
+
+	return fn, nil
+}
+
+// isBuiltinDriver 判断是否为内置的驱动，只有内置驱动会校验连接参数
+func isBuiltinDriver(name string) bool {
+	switch name {
+	case "mysql", "postgres", "clickhouse", "sqlite":
+		return true
+	default:
+		return false
+	}
+}
+
+func mysqlDriver(conf *Config) (gorm.Dialector, error) {
+	dsn, err := BuildDSN(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return mysql.New(mysql.Config{
+		DriverName:                "mysql",
+		DSN:                       dsn,   // DSN data source name
+		DefaultStringSize:         255,   // string 类型字段的默认长度
+		SkipInitializeWithVersion: false, // 根据版本自动配置
+	}), nil
+}
+
+func postgresDriver(conf *Config) (gorm.Dialector, error) {
+	dsn, err := BuildDSN(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// DriverName为空时使用pgx
+	return postgres.New(postgres.Config{
+		DSN: dsn, // DSN data source name
+	}), nil
+}
+
+func clickhouseDriver(conf *Config) (gorm.Dialector, error) {
+	dsn, err := BuildDSN(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return clickhouse.Open(dsn), nil
+}
+
+func sqliteDriver(conf *Config) (gorm.Dialector, error) {
+	dsn, err := BuildDSN(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlite.Open(dsn), nil
+}
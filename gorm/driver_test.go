@@ -0,0 +1,42 @@
+package gorm
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	require "github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRegisterDriver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mock.db")
+	var got *Config
+	RegisterDriver("mock", func(conf *Config) (gorm.Dialector, error) {
+		got = conf
+		return sqlite.Open(path), nil
+	})
+	RegisterDriver("broken", func(*Config) (gorm.Dialector, error) {
+		return nil, errors.New("no dialector")
+	})
+	t.Cleanup(func() {
+		driversMu.Lock()
+		delete(drivers, "mock")
+		delete(drivers, "broken")
+		driversMu.Unlock()
+	})
+	require.Contains(t, Drivers(), "mock")
+	require.Contains(t, Drivers(), "mysql")
+
+	// 自定义的驱动不校验连接参数
+	db := newTestEngine(t, &Config{Driver: "mock", Database: "orders"})
+	require.Equal(t, "orders", got.Database)
+	require.NoError(t, db.GetDB().Exec("SELECT 1").Error)
+
+	_, err := NewEngineE(&Config{Driver: "broken"})
+	var engineErr *EngineError
+	require.True(t, errors.As(err, &engineErr))
+	require.Equal(t, "broken", engineErr.Driver)
+	require.Contains(t, err.Error(), "no dialector")
+}
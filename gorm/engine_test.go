@@ -0,0 +1,81 @@
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestNewEngineEConfigError(t *testing.T) {
+	db, err := NewEngineE(&Config{Driver: "mysql", Server: "127.0.0.1"})
+	require.Nil(t, db)
+
+	var engineErr *EngineError
+	require.True(t, errors.As(err, &engineErr))
+	require.Equal(t, "mysql", engineErr.Driver)
+	require.Contains(t, err.Error(), "driver=mysql")
+
+	_, err = NewEngineE(&Config{Driver: "abc", Server: "127.0.0.1", User: "root", Password: "pw", Database: "db"})
+	require.True(t, errors.Is(err, ErrUnknownDriver))
+}
+
+func TestNewEngineEMaskPassword(t *testing.T) {
+	_, err := NewEngineE(&Config{
+		Driver:   "mysql",
+		Server:   "127.0.0.1",
+		Port:     1,
+		User:     "root",
+		Password: "my-secret-pw",
+		Database: "test_db",
+	})
+	require.Error(t, err)
+
+	var engineErr *EngineError
+	require.True(t, errors.As(err, &engineErr))
+	require.True(t, strings.HasPrefix(engineErr.DSN, "root:******@tcp(127.0.0.1:1)/test_db"), engineErr.DSN)
+	require.NotContains(t, err.Error(), "my-secret-pw")
+}
+
+func TestEngineErrorMask(t *testing.T) {
+	conf := &Config{Alias: "a", Driver: "mysql", User: "root", Password: "root"}
+	err := newEngineError(conf, "root:root@tcp(127.0.0.1:3306)/root",
+		fmt.Errorf("connect root:root@tcp(127.0.0.1:3306)/root: %w", ErrUnknownDriver))
+
+	// 短密码不会把用户名、库名也屏蔽掉
+	require.Equal(t, "root:******@tcp(127.0.0.1:3306)/root", err.DSN)
+	require.Contains(t, err.Error(), "connect root:******@tcp(127.0.0.1:3306)/root")
+	require.True(t, errors.Is(err, ErrUnknownDriver))
+
+	// 沿错误链取出的错误同样被屏蔽
+	for e := error(err); e != nil; e = errors.Unwrap(e) {
+		require.NotContains(t, e.Error(), "root:root")
+	}
+
+	err = newEngineError(&Config{Driver: "postgres", Password: "pw"}, "host=pg user=u password=pw dbname=db",
+		errors.New(`failed: password "pw" rejected`))
+	require.Equal(t, "host=pg user=u password=****** dbname=db", err.DSN)
+	require.NotContains(t, errors.Unwrap(err).Error(), "pw")
+}
+
+func TestNewEngineESqliteError(t *testing.T) {
+	_, err := NewEngineE(&Config{
+		Driver:   "sqlite",
+		Database: filepath.Join(t.TempDir(), "missing", "test.db"),
+	})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "155")
+}
+
+func TestRegisterDataBaseE(t *testing.T) {
+	err := RegisterDataBaseE("test-register-e", &Config{Driver: "abc"})
+	var engineErr *EngineError
+	require.True(t, errors.As(err, &engineErr))
+	require.Equal(t, "test-register-e", engineErr.Alias)
+	require.Nil(t, GetEngine("test-register-e"))
+
+	require.Panics(t, func() { RegisterDataBase("test-register-e", &Config{Driver: "abc"}) })
+}
@@ -1,6 +1,18 @@
 package gorm
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
@@ -9,4 +21,337 @@ var (
 	ErrRecordNotFound = gorm.ErrRecordNotFound
 	// ErrInvalidTransaction occurs when you are trying to `Commit` or `Rollback`
 	ErrInvalidTransaction = gorm.ErrInvalidTransaction
+	// ErrDefaultEngineRequired 在注册默认DB之前注册其他别名的DB时返回
+	ErrDefaultEngineRequired = errors.New("please set defalut db first")
+	// ErrEngineExists 是别名已经注册过
+	ErrEngineExists = errors.New("db alias already registered")
+	// ErrEngineNotFound 是别名未注册
+	ErrEngineNotFound = errors.New("db alias not registered")
+	// ErrUnknownDriver 是不支持的数据库驱动
+	ErrUnknownDriver = errors.New("error db driver")
 )
+
+// maskedPassword 是错误信息中替换密码的内容
+const maskedPassword = "******"
+
+// EngineError 是创建或注册DB实例失败时返回的错误，DSN及错误信息中的密码会被屏蔽
+type EngineError struct {
+	Alias  string
+	Driver string
+	DSN    string
+	// Err 是屏蔽了密码的原始错误，errors.Is、errors.As 仍可判断原始错误
+	Err error
+}
+
+func newEngineError(conf *Config, dsn string, err error) *EngineError {
+	e := &EngineError{
+		Alias:  conf.Alias,
+		Driver: conf.Driver,
+		DSN:    maskSecret(dsn, conf.Password),
+	}
+	if err != nil {
+		e.Err = &maskedError{msg: maskSecret(err.Error(), conf.Password), err: err}
+	}
+
+	return e
+}
+
+func (e *EngineError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("gorm: engine")
+	if e.Alias != "" {
+		fmt.Fprintf(&sb, " %q", e.Alias)
+	}
+	if e.Driver != "" {
+		fmt.Fprintf(&sb, " driver=%s", e.Driver)
+	}
+	if e.DSN != "" {
+		fmt.Fprintf(&sb, " dsn=%s", e.DSN)
+	}
+	if e.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(e.Err.Error())
+	}
+
+	return sb.String()
+}
+
+// Unwrap 返回屏蔽了密码的原始错误
+func (e *EngineError) Unwrap() error {
+	return e.Err
+}
+
+// maskedError 只输出屏蔽后的错误信息，不通过Unwrap暴露原始错误的信息
+type maskedError struct {
+	msg string
+	err error
+}
+
+func (e *maskedError) Error() string {
+	return e.msg
+}
+
+// Is 供errors.Is判断原始错误
+func (e *maskedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// As 供errors.As取出原始错误的类型，如 *mysql.MySQLError
+func (e *maskedError) As(target interface{}) bool {
+	return errors.As(e.err, target)
+}
+
+// maskSecret 屏蔽DSN形式的密码，以及跟在 : = 或引号后的password，避免短密码把用户名等内容也屏蔽掉
+func maskSecret(s, password string) string {
+	s = maskDSN(s)
+	if password == "" {
+		return s
+	}
+
+	re := regexp.MustCompile(`([:='"])` + regexp.QuoteMeta(password) + `($|[\s@'"&;,)])`)
+
+	return re.ReplaceAllString(s, "${1}"+maskedPassword+"${2}")
+}
+
+/* 跨驱动的错误分类，业务代码无需引入驱动包即可判断错误类型 */
+
+// mysql的错误码
+const (
+	mysqlErrTooManyConnections = 1040
+	mysqlErrBadHost            = 1042
+	mysqlErrHandshake          = 1043
+	mysqlErrUnknownCommand     = 1047
+	mysqlErrServerShutdown     = 1053
+	mysqlErrNormalShutdown     = 1077
+	mysqlErrNetRead            = 1158
+	mysqlErrNetWrite           = 1160
+	mysqlErrNetReadTimeout     = 1159
+	mysqlErrNetWriteTimeout    = 1161
+	mysqlErrDupEntry           = 1062
+	mysqlErrDupEntryWithKey    = 1586
+	mysqlErrDupUnique          = 1169
+	mysqlErrLockWaitTimeout    = 1205
+	mysqlErrDeadlock           = 1213
+	mysqlErrNoReferencedRow    = 1216
+	mysqlErrRowIsReferenced    = 1217
+	mysqlErrRowIsReferenced2   = 1451
+	mysqlErrNoReferencedRow2   = 1452
+	mysqlErrQueryTimeout       = 3024
+	mysqlErrLockNowait         = 3572
+)
+
+// sqlite的错误码，驱动开启了扩展错误码
+const (
+	sqliteBusy                 = 5
+	sqliteLocked               = 6
+	sqliteCantOpen             = 14
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// clickhouse的错误码
+const (
+	clickhouseTimeoutExceeded = 159
+	clickhouseSocketTimeout   = 209
+	clickhouseNetworkError    = 210
+	clickhouseDeadlockAvoided = 473
+)
+
+// sqliteError 是sqlite驱动的错误
+type sqliteError interface {
+	error
+	Code() int
+}
+
+// mysqlCode 返回mysql的错误码
+func mysqlCode(err error) (uint16, bool) {
+	var e *mysql.MySQLError
+	if errors.As(err, &e) {
+		return e.Number, true
+	}
+
+	return 0, false
+}
+
+// pgCode 返回postgres的SQLSTATE
+func pgCode(err error) (string, bool) {
+	var e *pgconn.PgError
+	if errors.As(err, &e) {
+		return e.Code, true
+	}
+
+	return "", false
+}
+
+// sqliteCode 返回sqlite的扩展错误码
+func sqliteCode(err error) (int, bool) {
+	var e sqliteError
+	if errors.As(err, &e) {
+		return e.Code(), true
+	}
+
+	return 0, false
+}
+
+// clickhouseCode 返回clickhouse的错误码
+func clickhouseCode(err error) (int32, bool) {
+	var e *proto.Exception
+	if errors.As(err, &e) {
+		return e.Code, true
+	}
+
+	return 0, false
+}
+
+// IsDuplicateKey 判断是否为违反主键或唯一索引的错误
+func IsDuplicateKey(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	if code, ok := mysqlCode(err); ok {
+		return code == mysqlErrDupEntry || code == mysqlErrDupEntryWithKey || code == mysqlErrDupUnique
+	}
+	if code, ok := pgCode(err); ok {
+		return code == "23505" // unique_violation
+	}
+	if code, ok := sqliteCode(err); ok {
+		return code == sqliteConstraintUnique || code == sqliteConstraintPrimaryKey
+	}
+
+	return false
+}
+
+// IsForeignKeyViolation 判断是否为违反外键约束的错误
+func IsForeignKeyViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrForeignKeyViolated) {
+		return true
+	}
+	if code, ok := mysqlCode(err); ok {
+		switch code {
+		case mysqlErrNoReferencedRow, mysqlErrRowIsReferenced, mysqlErrRowIsReferenced2, mysqlErrNoReferencedRow2:
+			return true
+		}
+		return false
+	}
+	if code, ok := pgCode(err); ok {
+		return code == "23503" // foreign_key_violation
+	}
+	if code, ok := sqliteCode(err); ok {
+		return code == sqliteConstraintForeignKey
+	}
+
+	return false
+}
+
+// IsDeadlock 判断是否为死锁，sqlite的数据库被锁定也视为死锁，此类错误重试事务通常可以成功
+func IsDeadlock(err error) bool {
+	if err == nil {
+		return false
+	}
+	if code, ok := mysqlCode(err); ok {
+		return code == mysqlErrDeadlock
+	}
+	if code, ok := pgCode(err); ok {
+		return code == "40P01" // deadlock_detected
+	}
+	if code, ok := sqliteCode(err); ok {
+		// 低8位为主错误码
+		return code&0xff == sqliteBusy || code&0xff == sqliteLocked
+	}
+	if code, ok := clickhouseCode(err); ok {
+		return code == clickhouseDeadlockAvoided
+	}
+
+	return false
+}
+
+// IsSerializationFailure 判断是否为可串行化隔离级别下的序列化失败，此类错误重试事务通常可以成功
+func IsSerializationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if code, ok := pgCode(err); ok {
+		return code == "40001" // serialization_failure
+	}
+
+	return false
+}
+
+// IsConnectionError 判断是否为连接失败、连接断开等连接相关的错误
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+	if code, ok := mysqlCode(err); ok {
+		switch code {
+		case mysqlErrTooManyConnections, mysqlErrBadHost, mysqlErrHandshake, mysqlErrUnknownCommand,
+			mysqlErrServerShutdown, mysqlErrNormalShutdown, mysqlErrNetRead, mysqlErrNetWrite:
+			return true
+		}
+		return false
+	}
+	if code, ok := pgCode(err); ok {
+		// 08 connection_exception，57P01 admin_shutdown，53300 too_many_connections
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "53300"
+	}
+	if code, ok := sqliteCode(err); ok {
+		return code&0xff == sqliteCantOpen
+	}
+	if code, ok := clickhouseCode(err); ok {
+		return code == clickhouseNetworkError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
+
+// IsTimeout 判断是否为查询超时、锁等待超时或网络超时
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if isLockTimeout(err) {
+		return true
+	}
+	if code, ok := mysqlCode(err); ok {
+		return code == mysqlErrQueryTimeout || code == mysqlErrNetReadTimeout || code == mysqlErrNetWriteTimeout
+	}
+	if code, ok := pgCode(err); ok {
+		return code == "57014" // query_canceled，statement_timeout触发
+	}
+	if code, ok := clickhouseCode(err); ok {
+		return code == clickhouseTimeoutExceeded || code == clickhouseSocketTimeout
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isLockTimeout 判断是否为等待行锁超时
+func isLockTimeout(err error) bool {
+	if code, ok := mysqlCode(err); ok {
+		return code == mysqlErrLockWaitTimeout || code == mysqlErrLockNowait
+	}
+	if code, ok := pgCode(err); ok {
+		return code == "55P03" // lock_not_available
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	require "github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fakeSqliteError int
+
+func (e fakeSqliteError) Error() string { return fmt.Sprintf("sqlite error (%d)", int(e)) }
+func (e fakeSqliteError) Code() int     { return int(e) }
+
+func TestErrorClassification(t *testing.T) {
+	classifiers := map[string]func(error) bool{
+		"duplicate":     IsDuplicateKey,
+		"foreign_key":   IsForeignKeyViolation,
+		"deadlock":      IsDeadlock,
+		"serialization": IsSerializationFailure,
+		"connection":    IsConnectionError,
+		"timeout":       IsTimeout,
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"mysql duplicate", &mysql.MySQLError{Number: 1062}, "duplicate"},
+		{"mysql foreign key", &mysql.MySQLError{Number: 1452}, "foreign_key"},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, "deadlock"},
+		{"mysql lock wait timeout", &mysql.MySQLError{Number: 1205}, "timeout"},
+		{"mysql too many connections", &mysql.MySQLError{Number: 1040}, "connection"},
+		{"mysql invalid conn", mysql.ErrInvalidConn, "connection"},
+		{"pg duplicate", &pgconn.PgError{Code: "23505"}, "duplicate"},
+		{"pg foreign key", &pgconn.PgError{Code: "23503"}, "foreign_key"},
+		{"pg deadlock", &pgconn.PgError{Code: "40P01"}, "deadlock"},
+		{"pg serialization", &pgconn.PgError{Code: "40001"}, "serialization"},
+		{"pg connection", &pgconn.PgError{Code: "08006"}, "connection"},
+		{"pg statement timeout", &pgconn.PgError{Code: "57014"}, "timeout"},
+		{"sqlite unique", fakeSqliteError(2067), "duplicate"},
+		{"sqlite primary key", fakeSqliteError(1555), "duplicate"},
+		{"sqlite foreign key", fakeSqliteError(787), "foreign_key"},
+		{"sqlite busy", fakeSqliteError(5), "deadlock"},
+		{"sqlite cant open", fakeSqliteError(14), "connection"},
+		{"clickhouse network", &proto.Exception{Code: 210}, "connection"},
+		{"clickhouse timeout", &proto.Exception{Code: 159}, "timeout"},
+		{"gorm duplicate", gorm.ErrDuplicatedKey, "duplicate"},
+		{"gorm foreign key", gorm.ErrForeignKeyViolated, "foreign_key"},
+		{"bad conn", driver.ErrBadConn, "connection"},
+		{"net", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, "connection"},
+		{"deadline", context.DeadlineExceeded, "timeout"},
+		{"record not found", ErrRecordNotFound, ""},
+		{"plain", errors.New("duplicate entry deadlock"), ""},
+	}
+
+	for _, c := range cases {
+		// 包装过的错误同样可以识别
+		wrapped := fmt.Errorf("create user: %w", c.err)
+		for name, classify := range classifiers {
+			require.Equal(t, name == c.want, classify(c.err), "%s %s", c.name, name)
+			require.Equal(t, name == c.want, classify(wrapped), "%s %s wrapped", c.name, name)
+		}
+	}
+
+	for name, classify := range classifiers {
+		require.False(t, classify(nil), name)
+	}
+}
+
+func TestIsDuplicateKeySqlite(t *testing.T) {
+	db := newTxEngine(t)
+
+	require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 1, Name: "a"}).Error)
+	err := db.Context(ctx).Create(&rwRecord{ID: 1, Name: "b"}).Error
+	require.Error(t, err)
+	require.True(t, IsDuplicateKey(err), err.Error())
+	require.False(t, IsConnectionError(err))
+}
+
+func TestTxRetryableError(t *testing.T) {
+	require.True(t, isRetryableTxError(&mysql.MySQLError{Number: 1213}))
+	require.True(t, isRetryableTxError(&mysql.MySQLError{Number: 1205}))
+	require.True(t, isRetryableTxError(&pgconn.PgError{Code: "40001"}))
+	require.True(t, isRetryableTxError(fakeSqliteError(5)))
+	require.False(t, isRetryableTxError(&mysql.MySQLError{Number: 1062}))
+	require.False(t, isRetryableTxError(nil))
+}
@@ -3,30 +3,20 @@ package gorm
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	viper "github.com/aixj1984/golibs/conf"
 
 	"github.com/aixj1984/golibs/zlog"
 
-	// Import MySQL database driver
-	// _ "github.com/jinzhu/gorm/dialects/mysql"
-	"gorm.io/driver/clickhouse"
-	"gorm.io/driver/mysql"
-
-	// Import PostgreSQL database driver
-	// _ "github.com/jinzhu/gorm/dialects/postgres"
-	"gorm.io/driver/postgres"
-
-	// Import SQLite3 database driver
-	//_ "github.com/jinzhu/gorm/dialects/sqlite"
-	//"gorm.io/driver/sqlite"
-	"github.com/glebarez/sqlite"
-
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/trace"
 
 	"gorm.io/gorm"
@@ -37,30 +27,31 @@ const (
 	parentSpanGormCtxKey = "opentracingParentSpanCtx"
 	spanGormKey          = "opentracingSpan"
 	spanDuration         = "opentracingSpanDuration"
+	tracerName           = "GORM-V2-SQL"
 	defaultEngine        = "default"
 )
 
 var (
 	defaultDatabase     = "mysql"
-	mysqlConnStrTmpl    = "%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=%s"
-	pgConnStrTmpl       = "host=%s port=%s user=%s dbname=%s password=%s TimeZone=%s"
-	ckConnStrTmpl       = "clickhouse://%s:%s@%s:%d/%s?dial_timeout=30s&max_execution_time=300"
 	defaultMaxOpenConns = 200
 	defaultMaxIdleConns = 60
 	defaultMaxLeftTime  = 300 * time.Second
 	defaultCharset      = "utf8mb4"
-	defaultPort         = 3306
+	defaultPorts        = map[string]int{"mysql": 3306, "postgres": 5432, "clickhouse": 9000}
 	defaultTimeZone     = "Local"
-	engineMap           map[string]*Engine
 )
 
 // Engine 是gorm的一个封装类
 type Engine struct {
-	gorm *gorm.DB
+	gorm      *gorm.DB
+	conf      *Config
+	replicas  *replicaRouter
+	callbacks *callbacks
+	stop      chan struct{}
+	stopOnce  sync.Once
 }
 
 func init() {
-	engineMap = make(map[string]*Engine)
 	dbCfg, err := viper.GetSubCfg[Config]("gorm")
 	if err != nil {
 		fmt.Printf("unable to get config, %s", err.Error())
@@ -75,124 +66,115 @@ func Open(dialector gorm.Dialector, opts ...gorm.Option) (db *DB, err error) {
 	return gorm.Open(dialector, opts...)
 }
 
-// GetEngine 通过别名，获取DB的实例
-func GetEngine(aliasNames ...string) *Engine {
-	if len(aliasNames) == 0 {
-		return engineMap[defaultEngine]
-	}
-	if _, ok := engineMap[aliasNames[0]]; ok {
-		return engineMap[aliasNames[0]]
-	}
-	return nil
-}
-
-// RegisterDataBase 注册一个别名的DB
-func RegisterDataBase(aliasName string, conf *Config) {
-	if len(engineMap) == 0 && aliasName != defaultEngine {
-		panic("please set defalut db first")
+// NewEngine 实例化新的Gorm实例，失败时panic
+func NewEngine(conf *Config) *Engine {
+	db, err := NewEngineE(conf)
+	if err != nil {
+		panic(err)
 	}
 
-	db := NewEngine(conf)
-	if db != nil {
-		engineMap[aliasName] = db
-	}
+	return db
 }
 
-// NewEngine 实例化新的Gorm实例
-func NewEngine(conf *Config) *Engine {
+// NewEngineE 实例化新的Gorm实例，失败时返回 *EngineError
+func NewEngineE(conf *Config) (*Engine, error) {
 	err := authConfig(conf)
 	if err != nil {
-		panic(err)
+		return nil, newEngineError(conf, "", err)
 	}
 
-	gormConf := &gorm.Config{}
-	var tempDB *gorm.DB
-	switch conf.Driver {
-	case "mysql":
-		dsn := fmt.Sprintf(mysqlConnStrTmpl,
-			conf.User,
-			conf.Password,
-			conf.Server,
-			conf.Port,
-			conf.Database,
-			conf.Charset,
-			conf.TimeZone)
-
-		mysqlConfig := mysql.Config{
-			DriverName:                conf.Driver,
-			DSN:                       dsn,   // DSN data source name
-			DefaultStringSize:         255,   // string 类型字段的默认长度
-			SkipInitializeWithVersion: false, // 根据版本自动配置
-		}
+	tempDB, dsn, err := connectGorm(conf)
+	if err != nil {
+		return nil, newEngineError(conf, dsn, err)
+	}
 
-		tempDB, err = gorm.Open(mysql.New(mysqlConfig), gormConf)
-		if err != nil {
-			panic(err)
-		}
+	zlog.Info("db connection successful", zlog.Fields{
+		"driver":   conf.Driver,
+		"server":   conf.Server,
+		"database": conf.Database,
+	})
 
-	case "postgres":
-		dsn := fmt.Sprintf(pgConnStrTmpl,
-			conf.Server,
-			conf.Port,
-			conf.User,
-			conf.Password,
-			conf.Database,
-			conf.TimeZone)
-		pgConfig := postgres.Config{
-			DriverName: conf.Driver,
-			DSN:        dsn, // DSN data source name
-		}
-		tempDB, err = gorm.Open(postgres.New(pgConfig), gormConf)
-		if err != nil {
-			panic(err)
-		}
+	newEngine := &Engine{gorm: tempDB, conf: conf, stop: make(chan struct{})}
+	newEngine.WrapLog()
 
-	case "clickhouse":
-		dsn := fmt.Sprintf(ckConnStrTmpl,
-			conf.User,
-			conf.Password,
-			conf.Server,
-			conf.Port,
-			conf.Database)
-		tempDB, err = gorm.Open(clickhouse.Open(dsn), &gorm.Config{})
-		if err != nil {
-			panic(err)
-		}
+	sqlDB, err := tempDB.DB()
+	if err != nil {
+		return nil, newEngineError(conf, dsn, err)
+	}
+	setPool(sqlDB, conf)
 
-	case "sqlite":
-		tempDB, err = gorm.Open(sqlite.Open(conf.Database), &gorm.Config{
-			DisableForeignKeyConstraintWhenMigrating: true,
-		})
+	if len(conf.Replicas) > 0 {
+		newEngine.replicas, err = newReplicaRouter(sqlDB, conf)
 		if err != nil {
-			panic("panic code: 155")
+			_ = sqlDB.Close() //nolint:errcheck
+			return nil, err
 		}
+		newEngine.replicas.register(tempDB)
+	}
 
-	default:
-		panic("error db driver")
+	newEngine.callbacks = addGormCallbacks(tempDB, conf)
+	if conf.PingInterval > 0 {
+		newEngine.startPinger(conf.PingInterval)
+	}
+	if conf.MetricsLogInterval > 0 {
+		newEngine.startMetricsLogger(conf.MetricsLogInterval)
 	}
 
-	fmt.Println("DB connection successful!")
+	return newEngine, nil
+}
 
-	newEngine := &Engine{tempDB}
-	newEngine.WrapLog()
+// openGorm 按驱动打开数据库，返回使用的DSN
+func openGorm(conf *Config) (tempDB *gorm.DB, dsn string, err error) {
+	// DSN只用于错误信息，自定义的驱动可能没有DSN
+	dsn, _ = BuildDSN(conf) //nolint:errcheck
 
-	sqlDB, err := tempDB.DB()
+	fn, err := lookupDriver(conf.Driver)
 	if err != nil {
-		panic(err)
+		return nil, dsn, err
+	}
+	dialector, err := fn(conf)
+	if err != nil {
+		return nil, dsn, err
 	}
 
+	gormConf := &gorm.Config{}
+	if conf.Driver == "sqlite" {
+		gormConf.DisableForeignKeyConstraintWhenMigrating = true
+	}
+	tempDB, err = gorm.Open(dialector, gormConf)
+
+	return tempDB, dsn, err
+}
+
+// setPool 设置连接池参数
+func setPool(sqlDB *sql.DB, conf *Config) {
 	sqlDB.SetConnMaxLifetime(conf.MaxLeftTime)
 	sqlDB.SetMaxIdleConns(conf.MaxIdleConns)
 	sqlDB.SetMaxOpenConns(conf.MaxOpenConns)
-
-	addGormCallbacks(tempDB)
-	return newEngine
 }
 
-// Context 设置db查询是的上下文
+// Context 设置db查询是的上下文，上下文中有 Tx 开启的事务时在事务中执行
 func (db *Engine) Context(ctx context.Context) *gorm.DB {
 	parentSpan := trace.SpanFromContext(ctx)
-	return db.gorm.WithContext(ctx).Set(parentSpanGormKey, parentSpan).Set(parentSpanGormCtxKey, ctx)
+	conn := db.gorm
+	if tx := db.txFromContext(ctx); tx != nil {
+		conn = tx
+	}
+	return conn.WithContext(ctx).Set(parentSpanGormKey, parentSpan).Set(parentSpanGormCtxKey, ctx)
+}
+
+// Close 关闭底层的连接池，包括从库的连接池
+func (db *Engine) Close() error {
+	sqlDB, err := db.gorm.DB()
+	if err != nil {
+		return err
+	}
+	db.stopOnce.Do(func() { close(db.stop) })
+	if db.replicas != nil {
+		db.replicas.close()
+	}
+
+	return sqlDB.Close()
 }
 
 // GetDB 获取当前实例中的db对象
@@ -200,16 +182,21 @@ func (db *Engine) GetDB() *gorm.DB {
 	return db.gorm
 }
 
-// SetLogMode 设置日志模式开关
+// SetLogMode 设置日志模式开关，打开时恢复为配置的日志等级
 func (db *Engine) SetLogMode(mode bool) {
-	if !mode {
-		db.gorm.Logger.LogMode(LogLevelSilent)
+	level := LogLevelSilent
+	if mode {
+		level = LogLevelInfo
+		if db.conf != nil {
+			level, _ = ParseLogLevel(db.conf.LogLevel) //nolint:errcheck
+		}
 	}
+	db.gorm.Logger = db.gorm.Logger.LogMode(level)
 }
 
 // SetLogLevel 设置输出日志的级别
 func (db *Engine) SetLogLevel(level LogLevel) {
-	db.gorm.Logger.LogMode(level)
+	db.gorm.Logger = db.gorm.Logger.LogMode(level)
 }
 
 /*
@@ -221,62 +208,86 @@ func Context(ctx context.Context, aliasName string) *gorm.DB {
 	return GetEngine(aliasName).gorm.Set(parentSpanGormKey, parentSpan).Set(parentSpanGormCtxKey, ctx)
 }*/
 
-func addGormCallbacks(db *gorm.DB) {
-	callbacks := newCallbacks()
+func addGormCallbacks(db *gorm.DB, conf *Config) *callbacks {
+	callbacks := newCallbacks(conf)
 	registerCallbacks(db, "create", callbacks)
 	registerCallbacks(db, "query", callbacks)
 	registerCallbacks(db, "update", callbacks)
 	registerCallbacks(db, "delete", callbacks)
 	registerCallbacks(db, "row_query", callbacks)
+	registerCallbacks(db, "raw", callbacks)
+	return callbacks
 }
 
-type callbacks struct{}
+type callbacks struct {
+	metrics *engineMetrics
+	conf    *Config
+	attrs   []attribute.KeyValue
+}
+
+func newCallbacks(conf *Config) *callbacks {
+	if conf == nil {
+		conf = &Config{}
+	}
 
-func newCallbacks() *callbacks {
-	return &callbacks{}
+	return &callbacks{metrics: newEngineMetrics(), conf: conf, attrs: connAttributes(conf)}
 }
 
-func (c *callbacks) beforeCreate(scope *gorm.DB)   { c.before(scope) }
-func (c *callbacks) afterCreate(scope *gorm.DB)    { c.after(scope) }
-func (c *callbacks) beforeQuery(scope *gorm.DB)    { c.before(scope) }
-func (c *callbacks) afterQuery(scope *gorm.DB)     { c.after(scope) }
-func (c *callbacks) beforeUpdate(scope *gorm.DB)   { c.before(scope) }
-func (c *callbacks) afterUpdate(scope *gorm.DB)    { c.after(scope) }
-func (c *callbacks) beforeDelete(scope *gorm.DB)   { c.before(scope) }
-func (c *callbacks) afterDelete(scope *gorm.DB)    { c.after(scope) }
-func (c *callbacks) beforeRowQuery(scope *gorm.DB) { c.before(scope) }
-func (c *callbacks) afterRowQuery(scope *gorm.DB)  { c.after(scope) }
-
-func (c *callbacks) before(db *gorm.DB) {
-	parentSpanCtx, ok := db.Get(parentSpanGormCtxKey)
-	if !ok {
-		// xlog.Infoln("no parentSpanCtx")
+func (c *callbacks) beforeCreate(scope *gorm.DB)   { c.before(scope, OpCreate) }
+func (c *callbacks) afterCreate(scope *gorm.DB)    { c.after(scope, OpCreate) }
+func (c *callbacks) beforeQuery(scope *gorm.DB)    { c.before(scope, OpQuery) }
+func (c *callbacks) afterQuery(scope *gorm.DB)     { c.after(scope, OpQuery) }
+func (c *callbacks) beforeUpdate(scope *gorm.DB)   { c.before(scope, OpUpdate) }
+func (c *callbacks) afterUpdate(scope *gorm.DB)    { c.after(scope, OpUpdate) }
+func (c *callbacks) beforeDelete(scope *gorm.DB)   { c.before(scope, OpDelete) }
+func (c *callbacks) afterDelete(scope *gorm.DB)    { c.after(scope, OpDelete) }
+func (c *callbacks) beforeRowQuery(scope *gorm.DB) { c.before(scope, OpRow) }
+func (c *callbacks) afterRowQuery(scope *gorm.DB)  { c.after(scope, OpRow) }
+func (c *callbacks) beforeRaw(scope *gorm.DB)      { c.before(scope, OpRaw) }
+func (c *callbacks) afterRaw(scope *gorm.DB)       { c.after(scope, OpRaw) }
+
+func (c *callbacks) before(db *gorm.DB, op string) {
+	db.Set(spanDuration, time.Now())
+	parentCtx := spanParent(db)
+	if parentCtx == nil {
 		return
 	}
-	db.Set(spanDuration, time.Now())
-	_, span := otel.Tracer("GORM-V2-SQL").Start(parentSpanCtx.(context.Context), db.Statement.Name())
+
+	_, span := otel.Tracer(tracerName).Start(parentCtx, spanName(db, op),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(c.attrs...))
 	db.Set(spanGormKey, span)
 }
 
-func (c *callbacks) after(scope *gorm.DB) {
+func (c *callbacks) after(scope *gorm.DB, op string) {
 	tempTime, ok := scope.Get(spanDuration)
 	if !ok {
 		tempTime = time.Now()
 	}
-	if span, ok := scope.Get(spanGormKey); ok {
-		vars, err := json.Marshal(scope.Statement.Vars)
-		if err != nil {
-			zlog.Errorf("json.Marshal Error : %s", err.Error())
-		} else {
-			span.(trace.Span).SetAttributes(attribute.Key("db.statement").String(string(vars)))
-			span.(trace.Span).SetAttributes(attribute.Key("db.sql").String(scope.Statement.SQL.String()))
-			if scope.Statement.Error != nil {
-				span.(trace.Span).SetAttributes(attribute.Key("db.err").String(scope.Statement.Error.Error()))
-			}
-			span.(trace.Span).SetAttributes(attribute.Key("db.took μs").Int64(time.Since(tempTime.(time.Time)).Microseconds()))
-		}
+	c.metrics.observe(op, time.Since(tempTime.(time.Time)), scope.Statement.Error)
+
+	val, ok := scope.Get(spanGormKey)
+	if !ok {
+		return
+	}
+	// 复用的Statement不能再次结束同一个span
+	scope.Statement.Settings.Delete(spanGormKey)
+	span := val.(trace.Span)
+	defer span.End()
+
+	attrs := []attribute.KeyValue{
+		semconv.DBOperationKey.String(operation(scope, op)),
+		semconv.DBStatementKey.String(c.statement(scope)),
+		attribute.Int64("db.rows_affected", scope.Statement.RowsAffected),
+	}
+	if table := scope.Statement.Table; table != "" {
+		attrs = append(attrs, semconv.DBSQLTableKey.String(table))
+	}
+	span.SetAttributes(attrs...)
 
-		defer span.(trace.Span).End()
+	if err := scope.Statement.Error; err != nil && !errors.Is(err, ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
 }
 
@@ -284,6 +295,10 @@ func registerCallbacks(db *gorm.DB, name string, c *callbacks) {
 	beforeName := fmt.Sprintf("tracing:%v_before", name)
 	afterName := fmt.Sprintf("tracing:%v_after", name)
 	gormCallbackName := fmt.Sprintf("gorm:%v", name)
+	if name == "row_query" {
+		// gorm中Row的回调名为gorm:row
+		gormCallbackName = "gorm:row"
+	}
 	switch name {
 	case "create":
 		_ = db.Callback().Create().Before(gormCallbackName).Register(beforeName, c.beforeCreate) //nolint:errcheck,staticcheck
@@ -300,5 +315,8 @@ func registerCallbacks(db *gorm.DB, name string, c *callbacks) {
 	case "row_query":
 		_ = db.Callback().Row().Before(gormCallbackName).Register(beforeName, c.beforeRowQuery) //nolint:errcheck,staticcheck
 		_ = db.Callback().Row().After(gormCallbackName).Register(afterName, c.afterRowQuery)    //nolint:errcheck,staticcheck
+	case "raw":
+		_ = db.Callback().Raw().Before(gormCallbackName).Register(beforeName, c.beforeRaw) //nolint:errcheck,staticcheck
+		_ = db.Callback().Raw().After(gormCallbackName).Register(afterName, c.afterRaw)    //nolint:errcheck,staticcheck
 	}
 }
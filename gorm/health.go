@@ -0,0 +1,195 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/aixj1984/golibs/zlog"
+)
+
+/* 启动时重试连接、后台保活及健康检查 */
+
+const (
+	// HealthUp 是数据库可用
+	HealthUp = "up"
+	// HealthDown 是数据库不可用
+	HealthDown = "down"
+)
+
+var (
+	defaultRetryInterval    = time.Second
+	defaultRetryMaxInterval = 30 * time.Second
+	defaultPingTimeout      = 5 * time.Second
+	defaultReadinessTimeout = 3 * time.Second
+)
+
+// HealthStatus 是DB实例的健康状态
+type HealthStatus struct {
+	Status  string        `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+	Stats   sql.DBStats   `json:"stats"`
+}
+
+// connectGorm 打开数据库，gorm.Open会ping数据库，失败时按配置的次数退避重试
+func connectGorm(conf *Config) (*gorm.DB, string, error) {
+	interval := conf.ConnectRetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	maxInterval := conf.ConnectRetryMaxInterval
+	if maxInterval <= 0 {
+		maxInterval = defaultRetryMaxInterval
+	}
+
+	for attempt := 0; ; attempt++ {
+		db, dsn, err := openGorm(conf)
+		if err == nil {
+			return db, dsn, nil
+		}
+		// ping失败时gorm.Open同时返回了db，需关闭其连接池
+		if db != nil {
+			closeGorm(db)
+		}
+		if errors.Is(err, ErrUnknownDriver) || attempt >= conf.ConnectRetries {
+			return nil, dsn, err
+		}
+
+		zlog.Warn("db connect failed, retrying", zlog.Fields{
+			"driver":   conf.Driver,
+			"server":   conf.Server,
+			"database": conf.Database,
+			"attempt":  attempt + 1,
+			"retries":  conf.ConnectRetries,
+			"backoff":  interval.String(),
+			"error":    newEngineError(conf, dsn, err).Error(),
+		})
+		time.Sleep(interval)
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func closeGorm(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close() //nolint:errcheck
+	}
+}
+
+// Health 检查DB实例的连接，返回状态、ping的耗时及连接池统计
+func (db *Engine) Health(ctx context.Context) HealthStatus {
+	sqlDB, err := db.gorm.DB()
+	if err != nil {
+		return HealthStatus{Status: HealthDown, Error: err.Error()}
+	}
+
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	status := HealthStatus{
+		Status:  HealthUp,
+		Latency: time.Since(start),
+		Stats:   sqlDB.Stats(),
+	}
+	if err != nil {
+		status.Status = HealthDown
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// startPinger 在后台定期ping数据库，保持连接并记录状态变化
+func (db *Engine) startPinger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		healthy := true
+		for {
+			select {
+			case <-db.stop:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), defaultPingTimeout)
+			status := db.Health(ctx)
+			cancel()
+
+			if up := status.Status == HealthUp; up != healthy {
+				healthy = up
+				fields := zlog.Fields{
+					"driver":   db.conf.Driver,
+					"server":   db.conf.Server,
+					"database": db.conf.Database,
+					"latency":  status.Latency.String(),
+				}
+				if up {
+					zlog.Info("db connection recovered", fields)
+				} else {
+					fields["error"] = status.Error
+					zlog.Error("db connection lost", fields)
+				}
+			}
+		}
+	}()
+}
+
+// Readiness 是所有已注册DB实例的健康状态
+type Readiness struct {
+	Status  string                  `json:"status"`
+	Engines map[string]HealthStatus `json:"engines"`
+}
+
+// CheckReadiness 检查所有已注册的DB实例，全部可用时状态为up
+func CheckReadiness(ctx context.Context) Readiness {
+	engines.mu.RLock()
+	all := make(map[string]*Engine, len(engines.engines))
+	for alias, db := range engines.engines {
+		all[alias] = db
+	}
+	engines.mu.RUnlock()
+
+	readiness := Readiness{Status: HealthUp, Engines: make(map[string]HealthStatus, len(all))}
+	for alias, db := range all {
+		status := db.Health(ctx)
+		if status.Status != HealthUp {
+			readiness.Status = HealthDown
+		}
+		readiness.Engines[alias] = status
+	}
+
+	return readiness
+}
+
+// ReadinessHandler 返回就绪检查的http.Handler，所有已注册的DB可用时返回200，否则返回503
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), defaultReadinessTimeout)
+		defer cancel()
+
+		readiness := CheckReadiness(ctx)
+		code := http.StatusOK
+		if readiness.Status != HealthUp {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(readiness) //nolint:errcheck,errchkjson
+	})
+}
+
+// GinReadinessHandler 返回gin的就绪检查处理函数，见 ReadinessHandler
+func GinReadinessHandler() gin.HandlerFunc {
+	return gin.WrapH(ReadinessHandler())
+}
@@ -0,0 +1,140 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/aixj1984/golibs/zlog"
+)
+
+func TestHealth(t *testing.T) {
+	db := newTestEngine(t, sqliteConfig(t, "health.db"))
+
+	status := db.Health(ctx)
+	require.Equal(t, HealthUp, status.Status)
+	require.Empty(t, status.Error)
+	require.Positive(t, status.Stats.MaxOpenConnections)
+
+	require.NoError(t, db.Close())
+	status = db.Health(ctx)
+	require.Equal(t, HealthDown, status.Status)
+	require.NotEmpty(t, status.Error)
+}
+
+func TestConnectRetry(t *testing.T) {
+	tl := zlog.NewTestLogger(t)
+
+	start := time.Now()
+	_, err := NewEngineE(&Config{
+		Driver:               "mysql",
+		Server:               "127.0.0.1",
+		Port:                 1,
+		User:                 "root",
+		Password:             "my-secret-pw",
+		Database:             "test_db",
+		ConnectRetries:       2,
+		ConnectRetryInterval: 10 * time.Millisecond,
+	})
+	require.Error(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+
+	tl.AssertLogged(zapcore.WarnLevel, "db connect failed, retrying", zlog.Fields{"attempt": 1})
+	tl.AssertLogged(zapcore.WarnLevel, "db connect failed, retrying", zlog.Fields{"attempt": 2})
+	tl.AssertNotLogged(zapcore.InfoLevel, "db connection successful")
+	for _, entry := range tl.Entries() {
+		fields, err := json.Marshal(entry.ContextMap())
+		require.NoError(t, err)
+		require.NotContains(t, string(fields), "my-secret-pw")
+	}
+}
+
+// refusedConnector 的连接总是失败
+type refusedConnector struct{}
+
+func (refusedConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (c refusedConnector) Driver() driver.Driver { return c }
+
+func (refusedConnector) Open(string) (driver.Conn, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestConnectRetryClosesPool(t *testing.T) {
+	// gorm.Open的ping失败时同时返回db，每次重试的连接池都需关闭
+	var pools []*sql.DB
+	RegisterDriver("refused", func(*Config) (gorm.Dialector, error) {
+		pool := sql.OpenDB(refusedConnector{})
+		pools = append(pools, pool)
+		return mysql.New(mysql.Config{Conn: pool, SkipInitializeWithVersion: true}), nil
+	})
+	RegisterDSNBuilder("refused", func(*Config) (string, error) { return "", nil })
+
+	_, err := NewEngineE(&Config{
+		Driver: "refused", Server: "127.0.0.1", Port: 1, User: "root", Database: "db",
+		ConnectRetries: 2, ConnectRetryInterval: time.Millisecond,
+	})
+	require.Error(t, err)
+	require.Len(t, pools, 3)
+	for _, pool := range pools {
+		require.ErrorContains(t, pool.Ping(), "database is closed")
+	}
+}
+
+func TestPinger(t *testing.T) {
+	tl := zlog.NewTestLogger(t)
+
+	conf := sqliteConfig(t, "pinger.db")
+	conf.PingInterval = 10 * time.Millisecond
+	db := newTestEngine(t, conf)
+
+	sqlDB, err := db.GetDB().DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	require.Eventually(t, func() bool {
+		return tl.Logged(zapcore.ErrorLevel, "db connection lost", nil)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReadinessHandler(t *testing.T) {
+	require.NoError(t, RegisterDataBaseE("test-readiness", sqliteConfig(t, "ready.db")))
+	t.Cleanup(func() { _ = Unregister("test-readiness") }) //nolint:errcheck
+
+	serve := func() (int, Readiness) {
+		rec := httptest.NewRecorder()
+		ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+		var readiness Readiness
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &readiness))
+
+		return rec.Code, readiness
+	}
+
+	code, readiness := serve()
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, HealthUp, readiness.Status)
+	require.Equal(t, HealthUp, readiness.Engines["test-readiness"].Status)
+
+	sqlDB, err := GetEngine("test-readiness").GetDB().DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	code, readiness = serve()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, HealthDown, readiness.Status)
+	require.Equal(t, HealthDown, readiness.Engines["test-readiness"].Status)
+}
@@ -0,0 +1,31 @@
+// Package gormtest 提供gorm子包测试中共用的sqlite实例，gorm包自身的测试因循环引用使用其中的 newTestEngine
+package gormtest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/aixj1984/golibs/gorm"
+	require "github.com/stretchr/testify/require"
+)
+
+// SQLiteConfig 返回测试临时目录中名为name的sqlite配置
+func SQLiteConfig(t testing.TB, name string) *gorm.Config {
+	t.Helper()
+
+	return &gorm.Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), name)}
+}
+
+// NewEngine 按conf创建实例并为models建表，测试结束时关闭
+func NewEngine(t testing.TB, conf *gorm.Config, models ...interface{}) *gorm.Engine {
+	t.Helper()
+
+	db, err := gorm.NewEngineE(conf)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+	if len(models) > 0 {
+		require.NoError(t, db.GetDB().AutoMigrate(models...))
+	}
+
+	return db
+}
@@ -1,6 +1,13 @@
 package gorm
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm/logger"
@@ -8,6 +15,12 @@ import (
 	"github.com/aixj1984/golibs/zlog"
 )
 
+var (
+	defaultSlowThreshold = 200 * time.Millisecond
+	// pkgPath 是本包的路径，获取调用位置时跳过本包及gorm的代码
+	pkgPath = reflect.TypeOf(Engine{}).PkgPath()
+)
+
 // Writer 重新定义gorm的writer类
 type Writer struct{}
 
@@ -16,20 +29,159 @@ func (w Writer) Printf(format string, args ...interface{}) {
 	zlog.Infof(format, args...)
 }
 
-// WrapLog 更新gorm的log实现
-func (db *Engine) WrapLog() {
-	if zlog.Logger() == nil {
+// ParseLogLevel 将 silent/error/warn/info 转换为日志等级，为空时为info
+func ParseLogLevel(level string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "silent":
+		return LogLevelSilent, nil
+	case "error":
+		return LogLevelError, nil
+	case "warn":
+		return LogLevelWarn, nil
+	case "", "info":
+		return LogLevelInfo, nil
+	default:
+		return LogLevelInfo, fmt.Errorf("unknown log level %s", level)
+	}
+}
+
+// zlogLogger 是通过zlog输出结构化日志的gorm logger，
+// 每次输出时才获取zlog的实例，因此可在zlog初始化之前创建
+type zlogLogger struct {
+	level             LogLevel
+	slowThreshold     time.Duration
+	parameterized     bool
+	logRecordNotFound bool
+}
+
+// NewLogger 按配置创建gorm的logger：出错的SQL输出error日志，慢查询输出warn日志，
+// 日志等级为info时输出所有SQL，字段为 sql、rows、elapsed、caller、trace_id
+func NewLogger(conf *Config) logger.Interface {
+	level, _ := ParseLogLevel(conf.LogLevel) //nolint:errcheck
+	slowThreshold := conf.SlowThreshold
+	if slowThreshold == 0 {
+		slowThreshold = defaultSlowThreshold
+	}
+
+	return &zlogLogger{
+		level:             level,
+		slowThreshold:     slowThreshold,
+		parameterized:     conf.ParameterizedQueries,
+		logRecordNotFound: conf.LogRecordNotFound,
+	}
+}
+
+// LogMode 实现logger.Interface
+func (l *zlogLogger) LogMode(level LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.level = level
+
+	return &newLogger
+}
+
+// Info 实现logger.Interface
+func (l *zlogLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= LogLevelInfo {
+		l.log(ctx, LogLevelInfo, fmt.Sprintf(msg, args...), zlog.Fields{"caller": sqlCaller()})
+	}
+}
+
+// Warn 实现logger.Interface
+func (l *zlogLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= LogLevelWarn {
+		l.log(ctx, LogLevelWarn, fmt.Sprintf(msg, args...), zlog.Fields{"caller": sqlCaller()})
+	}
+}
+
+// Error 实现logger.Interface
+func (l *zlogLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= LogLevelError {
+		l.log(ctx, LogLevelError, fmt.Sprintf(msg, args...), zlog.Fields{"caller": sqlCaller()})
+	}
+}
+
+// Trace 实现logger.Interface，输出执行的SQL
+func (l *zlogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= LogLevelSilent {
 		return
 	}
 
-	newLogger := logger.New(
-		Writer{},
-		logger.Config{
-			SlowThreshold:             200 * time.Millisecond, // Slow SQL threshold
-			LogLevel:                  logger.Info,            // Log level
-			IgnoreRecordNotFoundError: true,                   // Ignore ErrRecordNotFound error for logger
-			Colorful:                  false,                  // Disable color
-		},
-	)
-	db.gorm.Logger = newLogger
+	elapsed := time.Since(begin)
+	fields := func() zlog.Fields {
+		sql, rows := fc()
+		return zlog.Fields{
+			"sql":     sql,
+			"rows":    rows,
+			"elapsed": elapsed.String(),
+			"caller":  sqlCaller(),
+		}
+	}
+
+	switch {
+	case err != nil && l.level >= LogLevelError && (l.logRecordNotFound || !errors.Is(err, ErrRecordNotFound)):
+		f := fields()
+		f["error"] = err.Error()
+		l.log(ctx, LogLevelError, "gorm sql error", f)
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= LogLevelWarn:
+		f := fields()
+		f["slow_threshold"] = l.slowThreshold.String()
+		l.log(ctx, LogLevelWarn, "gorm slow sql", f)
+	case l.level >= LogLevelInfo:
+		l.log(ctx, LogLevelInfo, "gorm sql", fields())
+	}
+}
+
+// ParamsFilter 实现gorm的ParamsFilter，参数化时日志中的SQL不带参数值
+func (l *zlogLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.parameterized {
+		return sql, nil
+	}
+
+	return sql, params
+}
+
+// sqlCaller 返回业务代码中执行SQL的位置
+func sqlCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, "gorm.io/") ||
+			strings.HasPrefix(frame.Function, pkgPath+".") || strings.HasPrefix(frame.Function, pkgPath+"/")
+		if !internal || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func (l *zlogLogger) log(ctx context.Context, level LogLevel, msg string, fields zlog.Fields) {
+	entry := zlog.Logger()
+	if entry == nil {
+		zlog.Info(msg, fields)
+		return
+	}
+	if ctx != nil {
+		entry = entry.WithContext(ctx)
+	}
+
+	switch level {
+	case LogLevelError:
+		entry.Error(msg, fields)
+	case LogLevelWarn:
+		entry.Warn(msg, fields)
+	default:
+		entry.Info(msg, fields)
+	}
+}
+
+// WrapLog 更新gorm的log实现，按配置通过zlog输出结构化的日志
+func (db *Engine) WrapLog() {
+	conf := db.conf
+	if conf == nil {
+		conf = &Config{}
+	}
+	db.gorm.Logger = NewLogger(conf)
 }
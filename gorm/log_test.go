@@ -0,0 +1,100 @@
+package gorm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/aixj1984/golibs/zlog"
+)
+
+func newLogEngine(t *testing.T, modify func(*Config)) (*Engine, *zlog.TestLogger) {
+	t.Helper()
+
+	tl := zlog.NewTestLogger(t)
+	conf := sqliteConfig(t, "log.db")
+	if modify != nil {
+		modify(conf)
+	}
+	db := newTestEngine(t, conf, &rwRecord{})
+	tl.Reset()
+
+	return db, tl
+}
+
+func TestLoggerLevels(t *testing.T) {
+	db, tl := newLogEngine(t, nil)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	require.NoError(t, db.Context(spanCtx).Create(&rwRecord{ID: 1, Name: "a"}).Error)
+	tl.AssertLogged(zapcore.InfoLevel, "gorm sql", zlog.Fields{"rows": 1, "trace_id": traceID.String()})
+
+	var rec rwRecord
+	require.ErrorIs(t, db.GetDB().First(&rec, 2).Error, ErrRecordNotFound)
+	tl.AssertNotLogged(zapcore.ErrorLevel, "gorm sql error")
+
+	require.Error(t, db.GetDB().Table("missing").Find(&rec).Error)
+	tl.AssertLogged(zapcore.ErrorLevel, "gorm sql error", nil)
+
+	var found bool
+	for _, entry := range tl.Entries() {
+		content, _ := entry.ContextMap()["content"].(zlog.Fields)
+		if sql, _ := content["sql"].(string); strings.Contains(sql, "INSERT INTO") {
+			found = true
+			require.Contains(t, sql, `"a"`)
+			require.Contains(t, content["caller"], "log_test.go")
+			require.NotEmpty(t, content["elapsed"])
+		}
+	}
+	require.True(t, found)
+
+	tl.Reset()
+	db.SetLogLevel(LogLevelSilent)
+	require.NoError(t, db.GetDB().Find(&rec).Error)
+	require.Empty(t, tl.Entries())
+
+	db.SetLogMode(true)
+	require.NoError(t, db.GetDB().Find(&rec).Error)
+	tl.AssertLogged(zapcore.InfoLevel, "gorm sql", nil)
+}
+
+func TestLoggerSlowAndParameterized(t *testing.T) {
+	db, tl := newLogEngine(t, func(conf *Config) {
+		conf.LogLevel = "warn"
+		conf.SlowThreshold = time.Nanosecond
+		conf.ParameterizedQueries = true
+		conf.LogRecordNotFound = true
+	})
+
+	require.NoError(t, db.GetDB().Create(&rwRecord{ID: 1, Name: "secret"}).Error)
+	tl.AssertLogged(zapcore.WarnLevel, "gorm slow sql", zlog.Fields{"slow_threshold": "1ns"})
+	tl.AssertNotLogged(zapcore.InfoLevel, "gorm sql")
+	for _, entry := range tl.Entries() {
+		content, _ := entry.ContextMap()["content"].(zlog.Fields)
+		require.NotContains(t, content["sql"], "secret")
+	}
+
+	var rec rwRecord
+	require.ErrorIs(t, db.GetDB().First(&rec, 2).Error, ErrRecordNotFound)
+	tl.AssertLogged(zapcore.ErrorLevel, "gorm sql error", zlog.Fields{"error": ErrRecordNotFound.Error()})
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("WARN")
+	require.NoError(t, err)
+	require.Equal(t, LogLevelWarn, level)
+
+	_, err = ParseLogLevel("verbose")
+	require.Error(t, err)
+
+	_, err = NewEngineE(&Config{Driver: "sqlite", Database: "x.db", LogLevel: "verbose"})
+	require.Error(t, err)
+}
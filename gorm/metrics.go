@@ -0,0 +1,248 @@
+package gorm
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aixj1984/golibs/zlog"
+)
+
+/* DB实例的连接池统计及按操作的请求量、错误数及耗时分布 */
+
+const (
+	// OpCreate 是插入操作
+	OpCreate = "create"
+	// OpQuery 是查询操作
+	OpQuery = "query"
+	// OpUpdate 是更新操作
+	OpUpdate = "update"
+	// OpDelete 是删除操作
+	OpDelete = "delete"
+	// OpRow 是Row、Rows及Raw查询
+	OpRow = "row"
+	// OpRaw 是Exec执行的SQL
+	OpRaw = "raw"
+)
+
+var (
+	operations = []string{OpCreate, OpQuery, OpUpdate, OpDelete, OpRow, OpRaw}
+	// LatencyBuckets 是耗时分布的桶上限，单位秒
+	LatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+)
+
+// opMetrics 是一种操作的计数
+type opMetrics struct {
+	count   atomic.Uint64
+	errors  atomic.Uint64
+	sum     atomic.Int64
+	buckets []atomic.Uint64
+}
+
+// engineMetrics 是一个DB实例按操作的计数，操作是固定的，创建后只读
+type engineMetrics struct {
+	ops map[string]*opMetrics
+}
+
+func newEngineMetrics() *engineMetrics {
+	m := &engineMetrics{ops: make(map[string]*opMetrics, len(operations))}
+	for _, op := range operations {
+		m.ops[op] = &opMetrics{buckets: make([]atomic.Uint64, len(LatencyBuckets))}
+	}
+
+	return m
+}
+
+// observe 记录一次操作，查询不到记录不算错误
+func (m *engineMetrics) observe(op string, elapsed time.Duration, err error) {
+	o, ok := m.ops[op]
+	if !ok {
+		return
+	}
+
+	o.count.Add(1)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		o.errors.Add(1)
+	}
+	o.sum.Add(int64(elapsed))
+
+	seconds := elapsed.Seconds()
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			o.buckets[i].Add(1)
+			break
+		}
+	}
+}
+
+// OperationStats 是一种操作的统计，Buckets为与 LatencyBuckets 对应的累计次数
+type OperationStats struct {
+	Count   uint64        `json:"count"`
+	Errors  uint64        `json:"errors"`
+	Latency time.Duration `json:"latency"`
+	Buckets []uint64      `json:"buckets"`
+}
+
+// EngineStats 是DB实例的统计
+type EngineStats struct {
+	Pool       sql.DBStats               `json:"pool"`
+	Operations map[string]OperationStats `json:"operations"`
+}
+
+// Stats 返回连接池统计及按操作的统计
+func (db *Engine) Stats() EngineStats {
+	stats := EngineStats{Operations: make(map[string]OperationStats, len(operations))}
+	if sqlDB, err := db.gorm.DB(); err == nil {
+		stats.Pool = sqlDB.Stats()
+	}
+	if db.callbacks == nil {
+		return stats
+	}
+
+	for op, o := range db.callbacks.metrics.ops {
+		opStats := OperationStats{
+			Count:   o.count.Load(),
+			Errors:  o.errors.Load(),
+			Latency: time.Duration(o.sum.Load()),
+			Buckets: make([]uint64, len(LatencyBuckets)),
+		}
+		var cumulative uint64
+		for i := range o.buckets {
+			cumulative += o.buckets[i].Load()
+			opStats.Buckets[i] = cumulative
+		}
+		stats.Operations[op] = opStats
+	}
+
+	return stats
+}
+
+// startMetricsLogger 在后台定期将统计输出到日志
+func (db *Engine) startMetricsLogger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-db.stop:
+				return
+			case <-ticker.C:
+			}
+
+			stats := db.Stats()
+			fields := zlog.Fields{
+				"driver":        db.conf.Driver,
+				"server":        db.conf.Server,
+				"database":      db.conf.Database,
+				"open_conns":    stats.Pool.OpenConnections,
+				"in_use":        stats.Pool.InUse,
+				"idle":          stats.Pool.Idle,
+				"wait_count":    stats.Pool.WaitCount,
+				"wait_duration": stats.Pool.WaitDuration.String(),
+			}
+			for op, opStats := range stats.Operations {
+				fields[op] = zlog.Fields{"count": opStats.Count, "errors": opStats.Errors, "latency": opStats.Latency.String()}
+			}
+			zlog.Info("db stats", fields)
+		}
+	}()
+}
+
+// WriteMetrics 以Prometheus文本格式输出所有已注册DB实例的统计，标签engine为注册的别名
+func WriteMetrics(w io.Writer) error {
+	engines.mu.RLock()
+	aliases := make([]string, 0, len(engines.engines))
+	all := make(map[string]EngineStats, len(engines.engines))
+	for alias, db := range engines.engines {
+		aliases = append(aliases, alias)
+		all[alias] = db.Stats()
+	}
+	engines.mu.RUnlock()
+	sort.Strings(aliases)
+
+	var buf bytes.Buffer
+	gauge := func(name, help string, value func(sql.DBStats) float64) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, alias := range aliases {
+			fmt.Fprintf(&buf, "%s{engine=%q} %s\n", name, alias, formatFloat(value(all[alias].Pool)))
+		}
+	}
+	counter := func(name, help string, value func(sql.DBStats) float64) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, alias := range aliases {
+			fmt.Fprintf(&buf, "%s{engine=%q} %s\n", name, alias, formatFloat(value(all[alias].Pool)))
+		}
+	}
+
+	gauge("gorm_pool_max_open_connections", "Maximum number of open connections to the database.",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("gorm_pool_open_connections", "Number of established connections both in use and idle.",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("gorm_pool_in_use_connections", "Number of connections currently in use.",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("gorm_pool_idle_connections", "Number of idle connections.",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("gorm_pool_wait_count_total", "Total number of connections waited for.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("gorm_pool_wait_duration_seconds_total", "Total time blocked waiting for a new connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("gorm_pool_max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("gorm_pool_max_idle_time_closed_total", "Total number of connections closed due to SetConnMaxIdleTime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	counter("gorm_pool_max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+
+	buf.WriteString("# HELP gorm_operations_total Number of database operations.\n# TYPE gorm_operations_total counter\n")
+	for _, alias := range aliases {
+		for _, op := range operations {
+			fmt.Fprintf(&buf, "gorm_operations_total{engine=%q,operation=%q} %d\n", alias, op, all[alias].Operations[op].Count)
+		}
+	}
+	buf.WriteString("# HELP gorm_operation_errors_total Number of failed database operations, record not found excluded.\n# TYPE gorm_operation_errors_total counter\n")
+	for _, alias := range aliases {
+		for _, op := range operations {
+			fmt.Fprintf(&buf, "gorm_operation_errors_total{engine=%q,operation=%q} %d\n", alias, op, all[alias].Operations[op].Errors)
+		}
+	}
+	buf.WriteString("# HELP gorm_operation_duration_seconds Latency of database operations.\n# TYPE gorm_operation_duration_seconds histogram\n")
+	for _, alias := range aliases {
+		for _, op := range operations {
+			opStats := all[alias].Operations[op]
+			for i, bound := range LatencyBuckets {
+				var count uint64
+				if i < len(opStats.Buckets) {
+					count = opStats.Buckets[i]
+				}
+				fmt.Fprintf(&buf, "gorm_operation_duration_seconds_bucket{engine=%q,operation=%q,le=%q} %d\n", alias, op, formatFloat(bound), count)
+			}
+			fmt.Fprintf(&buf, "gorm_operation_duration_seconds_bucket{engine=%q,operation=%q,le=\"+Inf\"} %d\n", alias, op, opStats.Count)
+			fmt.Fprintf(&buf, "gorm_operation_duration_seconds_sum{engine=%q,operation=%q} %s\n", alias, op, formatFloat(opStats.Latency.Seconds()))
+			fmt.Fprintf(&buf, "gorm_operation_duration_seconds_count{engine=%q,operation=%q} %d\n", alias, op, opStats.Count)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+
+	return err
+}
+
+// MetricsHandler 返回以Prometheus文本格式输出统计的http.Handler，见 WriteMetrics
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WriteMetrics(w) //nolint:errcheck
+	})
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,69 @@
+package gorm
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/aixj1984/golibs/zlog"
+)
+
+func TestEngineStats(t *testing.T) {
+	db := newTestEngine(t, sqliteConfig(t, "stats.db"), &rwRecord{})
+	require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 1, Name: "a"}).Error)
+	require.NoError(t, db.GetDB().Model(&rwRecord{}).Where("id = ?", 1).Update("name", "b").Error)
+
+	var rec rwRecord
+	require.ErrorIs(t, db.GetDB().First(&rec, 2).Error, ErrRecordNotFound)
+	require.Error(t, db.GetDB().Table("missing").Find(&rec).Error)
+
+	stats := db.Stats()
+	require.Equal(t, uint64(1), stats.Operations[OpCreate].Count)
+	require.Equal(t, uint64(1), stats.Operations[OpUpdate].Count)
+	require.Equal(t, uint64(2), stats.Operations[OpQuery].Count)
+	require.Equal(t, uint64(1), stats.Operations[OpQuery].Errors)
+	require.Zero(t, stats.Operations[OpDelete].Count)
+	require.Positive(t, stats.Operations[OpQuery].Latency)
+
+	buckets := stats.Operations[OpQuery].Buckets
+	require.Len(t, buckets, len(LatencyBuckets))
+	require.LessOrEqual(t, buckets[len(buckets)-1], stats.Operations[OpQuery].Count)
+	require.Positive(t, stats.Pool.MaxOpenConnections)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	require.NoError(t, RegisterDataBaseE("test-metrics", sqliteConfig(t, "metrics.db")))
+	t.Cleanup(func() { _ = Unregister("test-metrics") }) //nolint:errcheck
+	require.NoError(t, GetEngine("test-metrics").GetDB().Exec("SELECT 1").Error)
+	var n int
+	require.NoError(t, GetEngine("test-metrics").GetDB().Raw("SELECT 1").Row().Scan(&n))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMetrics(&buf))
+	out := buf.String()
+	require.Contains(t, out, "# TYPE gorm_pool_open_connections gauge\n")
+	require.Contains(t, out, `gorm_operations_total{engine="test-metrics",operation="row"} 1`+"\n")
+	require.Contains(t, out, `gorm_operation_errors_total{engine="test-metrics",operation="row"} 0`+"\n")
+	require.Contains(t, out, `gorm_operation_duration_seconds_bucket{engine="test-metrics",operation="row",le="+Inf"} 1`+"\n")
+	require.Contains(t, out, `gorm_operation_duration_seconds_count{engine="test-metrics",operation="create"} 0`+"\n")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, rec.Body.String(), `gorm_pool_max_open_connections{engine="test-metrics"}`)
+}
+
+func TestMetricsLogger(t *testing.T) {
+	tl := zlog.NewTestLogger(t)
+
+	conf := sqliteConfig(t, "metrics-log.db")
+	conf.MetricsLogInterval = 10 * time.Millisecond
+	newTestEngine(t, conf)
+
+	require.Eventually(t, func() bool {
+		return tl.Logged(zapcore.InfoLevel, "db stats", zlog.Fields{"driver": "sqlite"})
+	}, time.Second, 10*time.Millisecond)
+}
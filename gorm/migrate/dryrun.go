@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aixj1984/golibs/gorm"
+	gormio "gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/* 在gorm的DryRun模式下执行Go编写的迁移，收集生成的SQL */
+
+// sqlRecorder 是收集SQL的logger.Interface
+type sqlRecorder struct {
+	statements []string
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *sqlRecorder) Info(context.Context, string, ...interface{}) {}
+
+func (r *sqlRecorder) Warn(context.Context, string, ...interface{}) {}
+
+func (r *sqlRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	if sql, _ := fc(); sql != "" {
+		r.statements = append(r.statements, sql)
+	}
+}
+
+// captureSQL 在DryRun模式下执行fn，返回生成的SQL
+func captureSQL(ctx context.Context, db *gorm.Engine, fn Func) (statements []string, err error) {
+	recorder := &sqlRecorder{}
+	tx := db.Context(ctx).Session(&gormio.Session{DryRun: true, Logger: recorder})
+
+	defer func() {
+		// DryRun模式下部分需要读取结果的操作会panic
+		if r := recover(); r != nil {
+			statements, err = recorder.statements, fmt.Errorf("unsupported in dry run: %v", r)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+
+	return recorder.statements, nil
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aixj1984/golibs/gorm"
+)
+
+/* 通过锁表防止多个进程同时执行迁移 */
+
+// lockID 是锁表中唯一一行的主键
+const lockID = 1
+
+// lockPollInterval 是等待锁时的轮询间隔
+var lockPollInterval = 100 * time.Millisecond
+
+// lockRecord 是锁表的记录，主键冲突时说明已被其他进程持有
+type lockRecord struct {
+	ID       int       `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string    `gorm:"size:128"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+// newOwner 返回标识当前进程的锁持有者
+func newOwner() string {
+	host, _ := os.Hostname() //nolint:errcheck
+	b := make([]byte, 4)
+	_, _ = rand.Read(b) //nolint:errcheck
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// lock 获取迁移锁，锁被其他进程持有时等待lockTimeout，超时返回 ErrLocked
+func (m *Migrator) lock(ctx context.Context) error {
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		err := m.session(ctx).Table(m.lockTable).
+			Create(&lockRecord{ID: lockID, Owner: m.owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			return nil
+		}
+		if !gorm.IsDuplicateKey(err) {
+			return err
+		}
+
+		if !time.Now().Before(deadline) {
+			var holder lockRecord
+			if m.session(ctx).Table(m.lockTable).Take(&holder, lockID).Error == nil {
+				return fmt.Errorf("%w by %s at %s", ErrLocked, holder.Owner, holder.LockedAt.Format(time.RFC3339))
+			}
+			return ErrLocked
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// unlock 释放当前进程持有的迁移锁
+func (m *Migrator) unlock(ctx context.Context) error {
+	return m.session(ctx).Table(m.lockTable).
+		Where("id = ? AND owner = ?", lockID, m.owner).Delete(&lockRecord{}).Error
+}
+
+// ForceUnlock 强制释放迁移锁，用于持有锁的进程异常退出后的恢复
+func (m *Migrator) ForceUnlock(ctx context.Context) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+
+	return m.session(ctx).Table(m.lockTable).Where("id = ?", lockID).Delete(&lockRecord{}).Error
+}
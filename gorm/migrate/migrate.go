@@ -0,0 +1,353 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aixj1984/golibs/gorm"
+	"github.com/aixj1984/golibs/zlog"
+)
+
+/* 基于Engine的版本化数据库迁移 */
+
+const (
+	// DefaultTable 是默认记录已执行迁移的表
+	DefaultTable = "schema_migrations"
+	// defaultLockSuffix 是锁表相对迁移表的后缀
+	defaultLockSuffix = "_lock"
+)
+
+var (
+	// ErrLocked 是迁移锁被其他进程持有
+	ErrLocked = errors.New("migrate: locked by another process")
+	// ErrDuplicateVersion 是存在相同版本的迁移
+	ErrDuplicateVersion = errors.New("migrate: duplicate version")
+	// ErrUnknownVersion 是指定的版本不存在
+	ErrUnknownVersion = errors.New("migrate: unknown version")
+	// ErrIrreversible 是迁移没有down，无法回滚
+	ErrIrreversible = errors.New("migrate: migration is irreversible")
+)
+
+// migrationRecord 是迁移表的记录
+type migrationRecord struct {
+	Version   uint64    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// Status 是一个迁移的执行状态
+type Status struct {
+	Version   uint64    `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	// Missing 为true时表示数据库中有执行记录，但代码中已没有该迁移
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Option 是 Migrator 的选项
+type Option func(*Migrator)
+
+// WithTable 设置记录迁移的表名，锁表为表名加 _lock 后缀
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.table = table
+		m.lockTable = table + defaultLockSuffix
+	}
+}
+
+// WithLockTimeout 设置等待迁移锁的最长时间，默认不等待
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+// Migrator 执行版本化的迁移，每个迁移在单独的事务中执行并记录到迁移表，
+// 注意mysql的DDL会隐式提交，失败时需要手动处理
+type Migrator struct {
+	db          *gorm.Engine
+	table       string
+	lockTable   string
+	lockTimeout time.Duration
+	owner       string
+	migrations  []*Migration
+}
+
+// New 创建一个Migrator
+func New(db *gorm.Engine, opts ...Option) *Migrator {
+	m := &Migrator{
+		db:        db,
+		table:     DefaultTable,
+		lockTable: DefaultTable + defaultLockSuffix,
+		owner:     newOwner(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Add 添加迁移，版本重复时返回 ErrDuplicateVersion
+func (m *Migrator) Add(migrations ...*Migration) error {
+	for _, mig := range migrations {
+		if !mig.hasUp() {
+			return fmt.Errorf("migrate: %s has no up migration", mig)
+		}
+		for _, exist := range m.migrations {
+			if exist.Version == mig.Version {
+				return fmt.Errorf("%w: %d (%s, %s)", ErrDuplicateVersion, mig.Version, exist.Name, mig.Name)
+			}
+		}
+		m.migrations = append(m.migrations, mig)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+
+	return nil
+}
+
+// session 返回走主库的DB，配置了从库时迁移记录及锁不能从可能延迟的从库读取
+func (m *Migrator) session(ctx context.Context) *gorm.DB {
+	return m.db.Context(gorm.WithPrimary(ctx))
+}
+
+// ensureTables 创建迁移表及锁表
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	db := m.session(ctx)
+	if err := db.Table(m.table).AutoMigrate(&migrationRecord{}); err != nil {
+		return err
+	}
+
+	return db.Table(m.lockTable).AutoMigrate(&lockRecord{})
+}
+
+// applied 返回已执行的迁移，key为版本
+func (m *Migrator) applied(ctx context.Context) (map[uint64]migrationRecord, error) {
+	var records []migrationRecord
+	if err := m.session(ctx).Table(m.table).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint64]migrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+
+	return applied, nil
+}
+
+// Status 返回所有迁移的执行状态，按版本排序
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, r.AppliedAt
+			delete(applied, mig.Version)
+		}
+		list = append(list, s)
+	}
+	for _, r := range applied {
+		list = append(list, Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Missing: true})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
+
+// Up 执行所有未执行的迁移
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.up(ctx, 0)
+}
+
+// UpTo 执行版本不大于version的未执行迁移
+func (m *Migrator) UpTo(ctx context.Context, version uint64) error {
+	if m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.up(ctx, version)
+}
+
+// Down 回滚最后执行的一个迁移，没有已执行的迁移时不做任何操作
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(applied map[uint64]migrationRecord) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				return m.run(ctx, m.migrations[i], false)
+			}
+		}
+
+		return nil
+	})
+}
+
+// DownTo 回滚版本大于version的所有已执行迁移，version为0时回滚全部
+func (m *Migrator) DownTo(ctx context.Context, version uint64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(applied map[uint64]migrationRecord) error {
+		for i := len(m.migrations) - 1; i >= 0 && m.migrations[i].Version > version; i-- {
+			if _, ok := applied[m.migrations[i].Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, m.migrations[i], false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DryRun 将未执行的迁移要执行的SQL输出到w，不修改数据库。Go编写的迁移在gorm的DryRun模式下执行，
+// 依赖查询结果的操作（如AutoMigrate需要先查询表结构）可能无法完整输出
+func (m *Migrator) DryRun(ctx context.Context, w io.Writer) error {
+	// 预览不修改数据库，迁移表不存在时视为没有执行过迁移
+	applied := make(map[uint64]migrationRecord)
+	if m.session(ctx).Migrator().HasTable(m.table) {
+		var err error
+		if applied, err = m.applied(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, mig := range m.pending(applied, 0) {
+		if _, err := fmt.Fprintf(w, "-- %s\n", mig); err != nil {
+			return err
+		}
+		statements := splitStatements(mig.UpSQL)
+		if mig.Up != nil {
+			captured, err := captureSQL(ctx, m.db, mig.Up)
+			if err != nil {
+				return fmt.Errorf("migrate: dry run %s: %w", mig, err)
+			}
+			statements = append(statements, captured...)
+		}
+		for _, stmt := range statements {
+			if _, err := fmt.Fprintf(w, "%s;\n", stmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) up(ctx context.Context, target uint64) error {
+	return m.withLock(ctx, func(applied map[uint64]migrationRecord) error {
+		for _, mig := range m.pending(applied, target) {
+			if err := m.run(ctx, mig, true); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// withLock 创建迁移表并持有迁移锁执行fn，applied为已执行的迁移
+func (m *Migrator) withLock(ctx context.Context, fn func(applied map[uint64]migrationRecord) error) (err error) {
+	if err = m.ensureTables(ctx); err != nil {
+		return err
+	}
+	if err = m.lock(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		// 上下文取消时仍需释放锁
+		if unlockErr := m.unlock(context.WithoutCancel(ctx)); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	return fn(applied)
+}
+
+// pending 返回未执行且版本不大于target的迁移，target为0时不限制
+func (m *Migrator) pending(applied map[uint64]migrationRecord, target uint64) []*Migration {
+	var list []*Migration
+	for _, mig := range m.migrations {
+		if target != 0 && mig.Version > target {
+			break
+		}
+		if _, ok := applied[mig.Version]; !ok {
+			list = append(list, mig)
+		}
+	}
+
+	return list
+}
+
+func (m *Migrator) find(version uint64) *Migration {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+
+	return nil
+}
+
+// run 在事务中执行一个迁移并更新迁移表
+func (m *Migrator) run(ctx context.Context, mig *Migration, up bool) error {
+	script, fn, direction := mig.UpSQL, mig.Up, "up"
+	if !up {
+		if !mig.hasDown() {
+			return fmt.Errorf("%w: %s", ErrIrreversible, mig)
+		}
+		script, fn, direction = mig.DownSQL, mig.Down, "down"
+	}
+
+	start := time.Now()
+	err := m.db.Tx(ctx, func(ctx context.Context) error {
+		tx := m.session(ctx)
+		for _, stmt := range splitStatements(script) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+
+		if up {
+			return tx.Table(m.table).Create(&migrationRecord{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Table(m.table).Where("version = ?", mig.Version).Delete(&migrationRecord{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migrate: %s %s: %w", direction, mig, err)
+	}
+
+	zlog.Info("db migration applied", zlog.Fields{
+		"version":   mig.Version,
+		"name":      mig.Name,
+		"direction": direction,
+		"elapsed":   time.Since(start).String(),
+	})
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aixj1984/golibs/gorm"
+	"github.com/aixj1984/golibs/gorm/internal/gormtest"
+	require "github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/migrations
+var migrationsFS embed.FS
+
+var ctx = context.Background()
+
+func newMigrator(t *testing.T, db *gorm.Engine, opts ...Option) *Migrator {
+	t.Helper()
+
+	m := New(db, opts...)
+	migrations, err := LoadFS(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+	require.NoError(t, m.Add(migrations...))
+
+	type order struct {
+		ID     int
+		UserID int
+	}
+	require.NoError(t, m.Add(&Migration{
+		Version: 3,
+		Name:    "create_orders",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&order{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&order{})
+		},
+	}))
+
+	return m
+}
+
+func appliedVersions(t *testing.T, m *Migrator) []uint64 {
+	t.Helper()
+
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+
+	var versions []uint64
+	for _, s := range list {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+
+	return versions
+}
+
+func TestUpDown(t *testing.T) {
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	m := newMigrator(t, db)
+
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.False(t, list[0].Applied)
+
+	require.NoError(t, m.UpTo(ctx, 1))
+	require.Equal(t, []uint64{1}, appliedVersions(t, m))
+	require.True(t, db.GetDB().Migrator().HasTable("users"))
+	require.False(t, db.GetDB().Migrator().HasColumn("users", "email"))
+
+	require.NoError(t, m.Up(ctx))
+	require.Equal(t, []uint64{1, 2, 3}, appliedVersions(t, m))
+	require.True(t, db.GetDB().Migrator().HasColumn("users", "email"))
+	require.True(t, db.GetDB().Migrator().HasTable("orders"))
+
+	// 重复执行不做任何操作
+	require.NoError(t, m.Up(ctx))
+
+	require.NoError(t, m.Down(ctx))
+	require.Equal(t, []uint64{1, 2}, appliedVersions(t, m))
+	require.False(t, db.GetDB().Migrator().HasTable("orders"))
+
+	require.NoError(t, m.DownTo(ctx, 0))
+	require.Empty(t, appliedVersions(t, m))
+	require.False(t, db.GetDB().Migrator().HasTable("users"))
+
+	require.True(t, errors.Is(m.UpTo(ctx, 9), ErrUnknownVersion))
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	m := New(db)
+	require.NoError(t, m.Add(&Migration{
+		Version: 1,
+		Name:    "broken",
+		UpSQL:   "CREATE TABLE t (id INTEGER);\nINSERT INTO missing VALUES (1);",
+	}))
+
+	err := m.Up(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "0001_broken")
+	require.Empty(t, appliedVersions(t, m))
+	require.False(t, db.GetDB().Migrator().HasTable("t"))
+
+	// 失败后锁已释放
+	require.NoError(t, m.lock(ctx))
+	require.NoError(t, m.unlock(ctx))
+}
+
+func TestIrreversible(t *testing.T) {
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	m := New(db)
+	require.NoError(t, m.Add(&Migration{Version: 1, Name: "a", UpSQL: "CREATE TABLE a (id INTEGER);"}))
+	require.NoError(t, m.Up(ctx))
+	require.True(t, errors.Is(m.Down(ctx), ErrIrreversible))
+
+	require.True(t, errors.Is(m.Add(&Migration{Version: 1, Name: "b", UpSQL: "SELECT 1;"}), ErrDuplicateVersion))
+}
+
+func TestLock(t *testing.T) {
+	lockPollInterval = time.Millisecond
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	holder := newMigrator(t, db)
+	require.NoError(t, holder.ensureTables(ctx))
+	require.NoError(t, holder.lock(ctx))
+
+	other := newMigrator(t, db, WithLockTimeout(10*time.Millisecond))
+	err := other.Up(ctx)
+	require.True(t, errors.Is(err, ErrLocked))
+	require.Contains(t, err.Error(), holder.owner)
+	require.Empty(t, appliedVersions(t, other))
+
+	// 其他进程持有的锁不会被释放
+	require.NoError(t, other.unlock(ctx))
+	require.True(t, errors.Is(other.Up(ctx), ErrLocked))
+
+	require.NoError(t, other.ForceUnlock(ctx))
+	require.NoError(t, other.Up(ctx))
+	require.Equal(t, []uint64{1, 2, 3}, appliedVersions(t, other))
+}
+
+func TestStatusMissing(t *testing.T) {
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	require.NoError(t, newMigrator(t, db).Up(ctx))
+
+	m := New(db)
+	require.NoError(t, m.Add(&Migration{Version: 1, Name: "create_users", UpSQL: "SELECT 1;"}))
+	list, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.False(t, list[0].Missing)
+	require.True(t, list[1].Applied)
+	require.True(t, list[1].Missing)
+	require.Equal(t, "add_email", list[1].Name)
+}
+
+func TestDryRun(t *testing.T) {
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	m := newMigrator(t, db, WithTable("migrations"))
+	require.NoError(t, m.UpTo(ctx, 1))
+
+	var buf bytes.Buffer
+	require.NoError(t, m.DryRun(ctx, &buf))
+	out := buf.String()
+	require.NotContains(t, out, "0001_create_users")
+	require.Contains(t, out, "-- 0002_add_email\nALTER TABLE users ADD COLUMN email VARCHAR(128);\n")
+	require.Contains(t, out, "-- 0003_create_orders\nCREATE TABLE `orders`")
+
+	// 没有修改数据库
+	require.Equal(t, []uint64{1}, appliedVersions(t, m))
+	require.False(t, db.GetDB().Migrator().HasColumn("users", "email"))
+	require.False(t, db.GetDB().Migrator().HasTable("orders"))
+	require.True(t, db.GetDB().Migrator().HasTable("migrations"))
+
+	// 新库上预览不创建迁移表及锁表
+	fresh := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "migrate.db"))
+	m = newMigrator(t, fresh)
+	buf.Reset()
+	require.NoError(t, m.DryRun(ctx, &buf))
+	require.Contains(t, buf.String(), "-- 0001_create_users\n")
+	require.False(t, fresh.GetDB().Migrator().HasTable(DefaultTable))
+	require.False(t, fresh.GetDB().Migrator().HasTable(DefaultTable+defaultLockSuffix))
+}
+
+func TestReplicaReadsPrimary(t *testing.T) {
+	// 从库是另一个空库，迁移记录及锁只能从主库读取
+	conf := gormtest.SQLiteConfig(t, "primary.db")
+	conf.Replicas = []gorm.Replica{{Database: filepath.Join(filepath.Dir(conf.Database), "replica.db")}}
+	db := gormtest.NewEngine(t, conf)
+
+	m := newMigrator(t, db)
+	require.NoError(t, m.Up(ctx))
+	require.Equal(t, []uint64{1, 2, 3}, appliedVersions(t, m))
+	require.NoError(t, m.Up(ctx))
+	require.NoError(t, m.Down(ctx))
+	require.Equal(t, []uint64{1, 2}, appliedVersions(t, m))
+}
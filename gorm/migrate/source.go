@@ -0,0 +1,173 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aixj1984/golibs/gorm"
+)
+
+/* 迁移的定义及从SQL文件加载迁移 */
+
+// Func 是用Go编写的迁移，tx在迁移的事务中执行
+type Func func(tx *gorm.DB) error
+
+// Migration 是一个版本的迁移，Up/Down为Go编写的迁移，UpSQL/DownSQL为SQL编写的迁移，
+// 同时设置时先执行SQL再执行Go函数
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      Func
+	Down    Func
+	UpSQL   string
+	DownSQL string
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+func (m *Migration) hasUp() bool {
+	return m.Up != nil || strings.TrimSpace(m.UpSQL) != ""
+}
+
+func (m *Migration) hasDown() bool {
+	return m.Down != nil || strings.TrimSpace(m.DownSQL) != ""
+}
+
+// sqlFileRe 匹配 0001_create_users.up.sql 格式的文件名
+var sqlFileRe = regexp.MustCompile(`^(\d+)_([\w-]+)\.(up|down)\.sql$`)
+
+// LoadFS 从fsys的dir目录加载SQL迁移，文件名格式为 版本_名称.up.sql 及 版本_名称.down.sql，
+// 其他文件会被忽略，通常与embed.FS一起使用
+func LoadFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := sqlFileRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version in %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: %d (%s, %s)", ErrDuplicateVersion, version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.UpSQL = string(content)
+		} else {
+			m.DownSQL = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !m.hasUp() {
+			return nil, fmt.Errorf("migrate: %s has no up migration", m)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// noSplitDirective 放在SQL文件开头时整个文件作为一条语句执行，用于驱动可以一次执行多条语句的场景
+const noSplitDirective = "-- migrate:no-split"
+
+// dollarTagRe 匹配postgres的 $$ 或 $tag$ 引用
+var dollarTagRe = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// splitStatements 按分号拆分SQL语句，忽略引号、$$ 引用及注释中的分号；
+// 文件以 -- migrate:no-split 开头时不拆分
+func splitStatements(script string) []string {
+	if trimmed := strings.TrimSpace(script); strings.HasPrefix(trimmed, noSplitDirective) {
+		if stmt := strings.TrimSpace(strings.TrimPrefix(trimmed, noSplitDirective)); stmt != "" {
+			return []string{stmt}
+		}
+		return nil
+	}
+
+	var (
+		statements []string
+		current    strings.Builder
+		hasCode    bool
+	)
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" && hasCode {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+		hasCode = false
+	}
+	// copyUntil 原样复制到end结束，没有结束时复制到末尾
+	copyUntil := func(rest, end string) int {
+		n := strings.Index(rest, end)
+		if n < 0 {
+			n = len(rest)
+		} else {
+			n += len(end)
+		}
+		current.WriteString(rest[:n])
+
+		return n
+	}
+
+	for i := 0; i < len(script); {
+		rest := script[i:]
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			hasCode = true
+			current.WriteByte(c)
+			i += 1 + copyUntil(rest[1:], string(c))
+		case strings.HasPrefix(rest, "--"):
+			// 行注释保留到行尾
+			i += copyUntil(rest, "\n")
+		case strings.HasPrefix(rest, "/*"):
+			i += copyUntil(rest, "*/")
+		case c == '$' && dollarTagRe.MatchString(rest):
+			hasCode = true
+			tag := dollarTagRe.FindString(rest)
+			current.WriteString(tag)
+			i += len(tag) + copyUntil(rest[len(tag):], tag)
+		case c == ';':
+			flush()
+			i++
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+			current.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+
+	return statements
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func TestLoadFS(t *testing.T) {
+	migrations, err := LoadFS(migrationsFS, "testdata/migrations")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Equal(t, uint64(1), migrations[0].Version)
+	require.Equal(t, "create_users", migrations[0].Name)
+	require.Contains(t, migrations[0].UpSQL, "CREATE TABLE users")
+	require.Contains(t, migrations[0].DownSQL, "DROP TABLE users")
+	require.Equal(t, "0002_add_email", migrations[1].String())
+
+	fsys := fstest.MapFS{
+		"sql/0003_c.up.sql": {Data: []byte("SELECT 1;")},
+		"sql/readme.md":     {Data: []byte("ignored")},
+	}
+	migrations, err = LoadFS(fsys, "sql")
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	require.Empty(t, migrations[0].DownSQL)
+
+	// 同一版本的文件名称不一致
+	fsys["sql/0003_d.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	_, err = LoadFS(fsys, "sql")
+	require.True(t, errors.Is(err, ErrDuplicateVersion))
+
+	// 只有down没有up
+	_, err = LoadFS(fstest.MapFS{"sql/0001_a.down.sql": {Data: []byte("SELECT 1;")}}, "sql")
+	require.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements(`
+-- 注释中的分号; 会被忽略
+CREATE TABLE a (name VARCHAR(8) DEFAULT 'x;y');
+INSERT INTO a VALUES ("it's;");
+
+-- 只有注释的语句不输出
+`)
+	require.Equal(t, []string{
+		"-- 注释中的分号; 会被忽略\nCREATE TABLE a (name VARCHAR(8) DEFAULT 'x;y')",
+		`INSERT INTO a VALUES ("it's;")`,
+	}, statements)
+
+	require.Empty(t, splitStatements("  \n-- only comment\n"))
+	require.Empty(t, splitStatements("/* only; comment */"))
+	require.Equal(t, []string{"SELECT 1"}, splitStatements("SELECT 1"))
+}
+
+func TestSplitStatementsBlockAndDollar(t *testing.T) {
+	statements := splitStatements(`
+/* 块注释中的分号; 会被忽略 */
+CREATE FUNCTION inc(i integer) RETURNS integer AS $$
+BEGIN
+    RETURN i + 1;
+END;
+$$ LANGUAGE plpgsql;
+CREATE FUNCTION dec(i integer) RETURNS integer AS $body$ BEGIN RETURN i - 1; END; $body$ LANGUAGE plpgsql;
+SELECT $1::int;
+`)
+	require.Equal(t, []string{
+		"/* 块注释中的分号; 会被忽略 */\nCREATE FUNCTION inc(i integer) RETURNS integer AS $$\nBEGIN\n    RETURN i + 1;\nEND;\n$$ LANGUAGE plpgsql",
+		"CREATE FUNCTION dec(i integer) RETURNS integer AS $body$ BEGIN RETURN i - 1; END; $body$ LANGUAGE plpgsql",
+		"SELECT $1::int",
+	}, statements)
+}
+
+func TestSplitStatementsNoSplit(t *testing.T) {
+	script := "-- migrate:no-split\nCREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = n + 1;\nEND;\n"
+	require.Equal(t, []string{"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET n = n + 1;\nEND;"}, splitStatements(script))
+	require.Empty(t, splitStatements("-- migrate:no-split\n"))
+}
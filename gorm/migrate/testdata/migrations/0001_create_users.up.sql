@@ -0,0 +1,6 @@
+-- 用户表
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(64) NOT NULL DEFAULT 'a;b'
+);
+CREATE INDEX idx_users_name ON users (name);
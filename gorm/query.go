@@ -0,0 +1,233 @@
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+/* 从HTTP查询参数构造DBConditions，只允许白名单中的列 */
+
+// ErrInvalidQuery 是查询参数不合法
+var ErrInvalidQuery = errors.New("invalid query")
+
+const (
+	// defaultPageSize 是未指定page_size时的每页条数
+	defaultPageSize = 20
+	// defaultMaxPageSize 是page_size的上限
+	defaultMaxPageSize = 100
+	// opSep 分隔字段名及操作符，如 age__gte
+	opSep = "__"
+)
+
+// QuerySpec 描述允许从查询参数构造的条件
+type QuerySpec struct {
+	// Filters 可过滤的参数名及对应的列名，如 {"name": "user_name"}
+	Filters map[string]string
+	// Sorts 可排序的参数名及对应的列名，未设置时与Filters相同
+	Sorts map[string]string
+	// DefaultSort 未指定sort时的排序，格式与sort参数一致，如 "-id"
+	DefaultSort string
+	// DefaultPageSize 未指定page_size时的每页条数，默认20
+	DefaultPageSize int
+	// MaxPageSize page_size的上限，默认100
+	MaxPageSize int
+}
+
+// queryOperators 是支持的操作符，参数格式为 字段名__操作符=值，省略操作符时为eq
+var queryOperators = map[string]func(col clause.Column, val string) (clause.Expression, error){
+	"eq": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Eq{Column: col, Value: val}, nil
+	},
+	"ne": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Neq{Column: col, Value: val}, nil
+	},
+	"gt": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Gt{Column: col, Value: val}, nil
+	},
+	"gte": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Gte{Column: col, Value: val}, nil
+	},
+	"lt": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Lt{Column: col, Value: val}, nil
+	},
+	"lte": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Lte{Column: col, Value: val}, nil
+	},
+	"in": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.IN{Column: col, Values: splitValues(val)}, nil
+	},
+	"nin": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Not(clause.IN{Column: col, Values: splitValues(val)}), nil
+	},
+	"like": func(col clause.Column, val string) (clause.Expression, error) {
+		return clause.Expr{SQL: "? LIKE ? ESCAPE ?", Vars: []interface{}{col, "%" + escapeLike(val) + "%", `\`}}, nil
+	},
+	"isnull": func(col clause.Column, val string) (clause.Expression, error) {
+		isNull, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, err
+		}
+		if isNull {
+			return clause.Eq{Column: col, Value: nil}, nil
+		}
+		return clause.Neq{Column: col, Value: nil}, nil
+	},
+}
+
+// 保留的查询参数
+const (
+	querySort     = "sort"
+	queryPage     = "page"
+	queryPageSize = "page_size"
+)
+
+// ConditionsFromQuery 从查询参数构造DBConditions，支持：
+//   - 过滤：name=tom、age__gte=18、id__in=1,2,3，操作符有 eq ne gt gte lt lte in nin like isnull
+//   - 排序：sort=-created_at,id，- 表示降序
+//   - 分页：page=2&page_size=20
+//
+// 只有spec中的参数会生成条件，列名来自spec而不是参数，其他参数被忽略；
+// 白名单中的参数使用了不支持的操作符或值不合法时返回 ErrInvalidQuery
+func ConditionsFromQuery(values url.Values, spec QuerySpec) (*DBConditions, error) {
+	cond := &DBConditions{}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == querySort || key == queryPage || key == queryPageSize {
+			continue
+		}
+
+		field, op := key, "eq"
+		if i := strings.LastIndex(key, opSep); i > 0 {
+			field, op = key[:i], key[i+len(opSep):]
+		}
+		column, ok := spec.Filters[field]
+		if !ok {
+			continue
+		}
+		build, ok := queryOperators[op]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported operator %q for %s", ErrInvalidQuery, op, field)
+		}
+
+		for _, val := range values[key] {
+			expr, err := build(clause.Column{Name: column}, val)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s=%s", ErrInvalidQuery, key, val)
+			}
+			cond.Where(expr)
+		}
+	}
+
+	order, err := spec.order(values.Get(querySort))
+	if err != nil {
+		return nil, err
+	}
+	if order != nil {
+		cond.Order = order
+	}
+
+	if err := spec.page(cond, values); err != nil {
+		return nil, err
+	}
+
+	return cond, nil
+}
+
+// order 解析排序参数
+func (s QuerySpec) order(sortParam string) (interface{}, error) {
+	if sortParam == "" {
+		sortParam = s.DefaultSort
+	}
+	if sortParam == "" {
+		return nil, nil
+	}
+
+	sorts := s.Sorts
+	if sorts == nil {
+		sorts = s.Filters
+	}
+
+	orderBy := clause.OrderBy{}
+	for _, field := range strings.Split(sortParam, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if field == "" {
+			continue
+		}
+
+		column, ok := sorts[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidQuery, field)
+		}
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: desc})
+	}
+	if len(orderBy.Columns) == 0 {
+		return nil, nil
+	}
+
+	return orderBy, nil
+}
+
+// page 解析分页参数
+func (s QuerySpec) page(cond *DBConditions, values url.Values) error {
+	pageSize, maxPageSize := s.DefaultPageSize, s.MaxPageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if maxPageSize <= 0 {
+		maxPageSize = defaultMaxPageSize
+	}
+
+	page := 1
+	if val := values.Get(queryPage); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%w: page=%s", ErrInvalidQuery, val)
+		}
+		page = n
+	}
+	if val := values.Get(queryPageSize); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%w: page_size=%s", ErrInvalidQuery, val)
+		}
+		pageSize = n
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	cond.Paginate(page, pageSize)
+
+	return nil
+}
+
+func splitValues(val string) []interface{} {
+	parts := strings.Split(val, ",")
+	values := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		values = append(values, strings.TrimSpace(part))
+	}
+
+	return values
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike 转义LIKE中的通配符
+func escapeLike(val string) string {
+	return likeReplacer.Replace(val)
+}
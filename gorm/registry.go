@@ -0,0 +1,223 @@
+package gorm
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aixj1984/golibs/zlog"
+)
+
+/* 线程安全的DB实例注册表 */
+
+// engineRegistry 保存按别名注册的DB实例
+type engineRegistry struct {
+	mu      sync.RWMutex
+	engines map[string]*Engine
+	// retiring 是被替换后等待关闭的实例
+	retiring map[*Engine]*time.Timer
+}
+
+var engines = &engineRegistry{
+	engines:  make(map[string]*Engine),
+	retiring: make(map[*Engine]*time.Timer),
+}
+
+func (r *engineRegistry) get(alias string) *Engine {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.engines[alias]
+}
+
+// checkDefault 检查注册其他别名前是否已注册了默认DB，需在持有锁时调用
+func (r *engineRegistry) checkDefault(alias string) error {
+	if len(r.engines) == 0 && alias != defaultEngine {
+		return ErrDefaultEngineRequired
+	}
+
+	return nil
+}
+
+// EngineInfo 是已注册DB实例的信息
+type EngineInfo struct {
+	Alias    string `json:"alias"`
+	Driver   string `json:"driver"`
+	Server   string `json:"server"`
+	Database string `json:"database"`
+}
+
+// GetEngine 通过别名，获取DB的实例
+func GetEngine(aliasNames ...string) *Engine {
+	if len(aliasNames) == 0 {
+		return engines.get(defaultEngine)
+	}
+
+	return engines.get(aliasNames[0])
+}
+
+// ReplaceGracePeriod 是别名被覆盖或替换后，旧实例延迟关闭的时间，
+// 期间仍持有旧实例的调用可以继续执行；<=0 时立即关闭
+var ReplaceGracePeriod = 30 * time.Second
+
+// RegisterDataBase 注册一个别名的DB，失败时panic
+func RegisterDataBase(aliasName string, conf *Config) {
+	if err := RegisterDataBaseE(aliasName, conf); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterDataBaseE 注册一个别名的DB，失败时返回 *EngineError；
+// 别名已注册时覆盖，旧实例在 ReplaceGracePeriod 后关闭
+func RegisterDataBaseE(aliasName string, conf *Config) error {
+	return engines.register(aliasName, conf, false)
+}
+
+// RegisterDataBaseStrict 注册一个别名的DB，别名已注册时返回 ErrEngineExists，不会覆盖
+func RegisterDataBaseStrict(aliasName string, conf *Config) error {
+	return engines.register(aliasName, conf, true)
+}
+
+// Replace 用新的配置创建DB实例并替换已注册的实例，旧实例在 ReplaceGracePeriod 后关闭；
+// 新实例创建失败时保留旧实例。别名未注册时等同于注册
+func Replace(aliasName string, conf *Config) error {
+	return engines.register(aliasName, conf, false)
+}
+
+// register 创建DB实例并注册，strict为true时别名已注册返回 ErrEngineExists
+func (r *engineRegistry) register(aliasName string, conf *Config, strict bool) error {
+	check := func() error {
+		if err := r.checkDefault(aliasName); err != nil {
+			return err
+		}
+		if strict && r.engines[aliasName] != nil {
+			return ErrEngineExists
+		}
+
+		return nil
+	}
+
+	r.mu.RLock()
+	err := check()
+	r.mu.RUnlock()
+	if err != nil {
+		return &EngineError{Alias: aliasName, Driver: conf.Driver, Err: err}
+	}
+
+	db, err := newAliasEngine(aliasName, conf)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if err = check(); err != nil {
+		// 创建期间被并发注册
+		r.mu.Unlock()
+		_ = db.Close() //nolint:errcheck
+
+		return &EngineError{Alias: aliasName, Driver: conf.Driver, Err: err}
+	}
+	old := r.engines[aliasName]
+	r.engines[aliasName] = db
+	if old != nil {
+		r.retire(aliasName, old)
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// retire 在宽限期后关闭被替换的实例，需在持有锁时调用
+func (r *engineRegistry) retire(aliasName string, old *Engine) {
+	closeOld := func() {
+		r.mu.Lock()
+		delete(r.retiring, old)
+		r.mu.Unlock()
+
+		if err := old.Close(); err != nil {
+			zlog.Warn("replaced db close failed", zlog.Fields{"alias": aliasName, "error": err.Error()})
+		}
+	}
+
+	if ReplaceGracePeriod <= 0 {
+		go closeOld()
+		return
+	}
+	r.retiring[old] = time.AfterFunc(ReplaceGracePeriod, closeOld)
+}
+
+// Unregister 注销指定别名的DB并关闭其连接池，别名未注册时返回 ErrEngineNotFound
+func Unregister(aliasName string) error {
+	engines.mu.Lock()
+	db, ok := engines.engines[aliasName]
+	delete(engines.engines, aliasName)
+	engines.mu.Unlock()
+
+	if !ok {
+		return ErrEngineNotFound
+	}
+
+	return db.Close()
+}
+
+// CloseAll 注销所有DB并关闭连接池，包括等待关闭的旧实例，用于程序退出
+func CloseAll() error {
+	engines.mu.Lock()
+	all := make([]*Engine, 0, len(engines.engines)+len(engines.retiring))
+	for _, db := range engines.engines {
+		all = append(all, db)
+	}
+	for db, timer := range engines.retiring {
+		if timer.Stop() {
+			all = append(all, db)
+		}
+	}
+	engines.engines = make(map[string]*Engine)
+	engines.retiring = make(map[*Engine]*time.Timer)
+	engines.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, db := range all {
+		if err := db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Engines 返回所有已注册的DB实例信息，按别名排序
+func Engines() []EngineInfo {
+	engines.mu.RLock()
+	infos := make([]EngineInfo, 0, len(engines.engines))
+	for alias, db := range engines.engines {
+		info := EngineInfo{Alias: alias}
+		if db.conf != nil {
+			info.Driver = db.conf.Driver
+			info.Server = db.conf.Server
+			info.Database = db.conf.Database
+		}
+		infos = append(infos, info)
+	}
+	engines.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Alias < infos[j].Alias })
+
+	return infos
+}
+
+// newAliasEngine 创建DB实例，错误中带上别名
+func newAliasEngine(aliasName string, conf *Config) (*Engine, error) {
+	db, err := NewEngineE(conf)
+	if err != nil {
+		var engineErr *EngineError
+		if errors.As(err, &engineErr) {
+			engineErr.Alias = aliasName
+		}
+
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,116 @@
+package gorm
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func sqliteConfig(t *testing.T, name string) *Config {
+	t.Helper()
+
+	return &Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), name)}
+}
+
+// newTestEngine 按conf创建实例并为models建表，测试结束时关闭
+func newTestEngine(t *testing.T, conf *Config, models ...interface{}) *Engine {
+	t.Helper()
+
+	db, err := NewEngineE(conf)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() }) //nolint:errcheck
+	if len(models) > 0 {
+		require.NoError(t, db.GetDB().AutoMigrate(models...))
+	}
+
+	return db
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	conf := sqliteConfig(t, "a.db")
+	require.NoError(t, RegisterDataBaseE("test-registry", conf))
+	t.Cleanup(func() { _ = Unregister("test-registry") }) //nolint:errcheck
+
+	first := GetEngine("test-registry")
+	require.NotNil(t, first)
+
+	err := RegisterDataBaseStrict("test-registry", sqliteConfig(t, "b.db"))
+	require.True(t, errors.Is(err, ErrEngineExists))
+	require.Same(t, first, GetEngine("test-registry"))
+
+	var found bool
+	for _, info := range Engines() {
+		if info.Alias == "test-registry" {
+			found = true
+			require.Equal(t, "sqlite", info.Driver)
+			require.Equal(t, conf.Database, info.Database)
+		}
+	}
+	require.True(t, found)
+
+	// 替换失败时保留旧实例
+	require.Error(t, Replace("test-registry", &Config{Driver: "abc"}))
+	require.Same(t, first, GetEngine("test-registry"))
+
+	prevGrace := ReplaceGracePeriod
+	ReplaceGracePeriod = 50 * time.Millisecond
+	t.Cleanup(func() { ReplaceGracePeriod = prevGrace })
+
+	require.NoError(t, Replace("test-registry", sqliteConfig(t, "b.db")))
+	second := GetEngine("test-registry")
+	require.NotSame(t, first, second)
+	// 宽限期内旧实例仍可使用，之后关闭
+	require.NoError(t, first.GetDB().Exec("SELECT 1").Error)
+	require.Eventually(t, func() bool { return first.GetDB().Exec("SELECT 1").Error != nil }, time.Second, 10*time.Millisecond,
+		"old pool should be closed")
+	require.NoError(t, second.GetDB().Exec("SELECT 1").Error)
+
+	require.NoError(t, Unregister("test-registry"))
+	require.Nil(t, GetEngine("test-registry"))
+	require.Error(t, second.GetDB().Exec("SELECT 1").Error)
+	require.True(t, errors.Is(Unregister("test-registry"), ErrEngineNotFound))
+}
+
+func TestRegisterDataBaseOverwrite(t *testing.T) {
+	prevGrace := ReplaceGracePeriod
+	ReplaceGracePeriod = time.Hour
+	t.Cleanup(func() { ReplaceGracePeriod = prevGrace })
+
+	// 与原有行为一致，重复注册时覆盖
+	RegisterDataBase("test-overwrite", sqliteConfig(t, "a.db"))
+	t.Cleanup(func() { _ = Unregister("test-overwrite") }) //nolint:errcheck
+	first := GetEngine("test-overwrite")
+	require.NotPanics(t, func() { RegisterDataBase("test-overwrite", sqliteConfig(t, "b.db")) })
+	require.NotSame(t, first, GetEngine("test-overwrite"))
+	require.NoError(t, first.GetDB().Exec("SELECT 1").Error)
+
+	engines.mu.RLock()
+	_, retiring := engines.retiring[first]
+	engines.mu.RUnlock()
+	require.True(t, retiring)
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	require.NoError(t, RegisterDataBaseE("test-concurrent", sqliteConfig(t, "c.db")))
+	t.Cleanup(func() { _ = Unregister("test-concurrent") }) //nolint:errcheck
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = GetEngine("test-concurrent")
+			_ = Engines()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = Replace("test-concurrent", sqliteConfig(t, "c.db")) //nolint:errcheck
+		}()
+	}
+	wg.Wait()
+	require.NotNil(t, GetEngine("test-concurrent"))
+}
@@ -0,0 +1,162 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/* 读写分离，查询走从库，写入及事务走主库 */
+
+const (
+	// ReplicaPolicyRoundRobin 轮询选择从库
+	ReplicaPolicyRoundRobin = "round_robin"
+	// ReplicaPolicyRandom 随机选择从库
+	ReplicaPolicyRandom = "random"
+)
+
+// lockingSQLRe 匹配加锁读取的SQL
+var lockingSQLRe = regexp.MustCompile(`(?i)\b(for\s+(no\s+key\s+)?update|for\s+(key\s+)?share|lock\s+in\s+share\s+mode)\b`)
+
+type primaryCtxKey struct{}
+
+// WithPrimary 返回强制走主库的上下文，用于写入后立即读取等场景
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// usePrimary 判断上下文是否要求走主库
+func usePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	force, _ := ctx.Value(primaryCtxKey{}).(bool)
+
+	return force
+}
+
+// replicaRouter 将查询路由到从库
+type replicaRouter struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	policy   string
+	next     atomic.Uint64
+}
+
+// newReplicaRouter 打开所有从库，从库的连接池参数与主库一致
+func newReplicaRouter(primary *sql.DB, conf *Config) (*replicaRouter, error) {
+	r := &replicaRouter{primary: primary, policy: conf.ReplicaPolicy}
+	for _, replica := range conf.Replicas {
+		replicaConf := replica.config(conf)
+		replicaDB, dsn, err := openGorm(replicaConf)
+		if err != nil {
+			if replicaDB != nil {
+				closeGorm(replicaDB)
+			}
+			r.close()
+			return nil, newEngineError(replicaConf, dsn, err)
+		}
+
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			r.close()
+			return nil, newEngineError(replicaConf, dsn, err)
+		}
+		setPool(sqlDB, replicaConf)
+		r.replicas = append(r.replicas, sqlDB)
+	}
+
+	return r, nil
+}
+
+// config 返回从库的完整配置
+func (r Replica) config(primary *Config) *Config {
+	conf := *primary
+	conf.Replicas = nil
+	// 主库的DSN不适用于从库
+	conf.DSN = r.DSN
+	if r.Server != "" {
+		conf.Server = r.Server
+	}
+	if r.Port != 0 {
+		conf.Port = r.Port
+	}
+	if r.Database != "" {
+		conf.Database = r.Database
+	}
+	if r.User != "" {
+		conf.User = r.User
+	}
+	if r.Password != "" {
+		conf.Password = r.Password
+	}
+
+	return &conf
+}
+
+func (r *replicaRouter) register(db *gorm.DB) {
+	_ = db.Callback().Query().Before("gorm:query").Register("rw:replica_before", r.route) //nolint:errcheck,staticcheck
+	_ = db.Callback().Query().After("gorm:query").Register("rw:replica_after", r.restore) //nolint:errcheck,staticcheck
+	_ = db.Callback().Row().Before("gorm:row").Register("rw:replica_row_before", r.route) //nolint:errcheck,staticcheck
+	_ = db.Callback().Row().After("gorm:row").Register("rw:replica_row_after", r.restore) //nolint:errcheck,staticcheck
+}
+
+// route 将查询切换到从库，事务中、加锁查询、强制主库及非SELECT的原生SQL不切换
+func (r *replicaRouter) route(db *gorm.DB) {
+	// 事务中ConnPool为*sql.Tx
+	if db.Statement.ConnPool != r.primary {
+		return
+	}
+	if usePrimary(db.Statement.Context) {
+		return
+	}
+	if _, ok := db.Statement.Clauses[clause.Locking{}.Name()]; ok {
+		return
+	}
+	// Raw().Scan()等也会执行查询回调，此时SQL已生成，如 INSERT ... RETURNING 需走主库
+	if rawSQL := db.Statement.SQL.String(); rawSQL != "" && !isReadSQL(rawSQL) {
+		return
+	}
+
+	db.Statement.ConnPool = r.pick()
+}
+
+// restore 查询结束后切换回主库，避免复用的Statement写入从库
+func (r *replicaRouter) restore(db *gorm.DB) {
+	for _, replica := range r.replicas {
+		if db.Statement.ConnPool == replica {
+			db.Statement.ConnPool = r.primary
+			return
+		}
+	}
+}
+
+// isReadSQL 判断原生SQL是否为不加锁的SELECT
+func isReadSQL(rawSQL string) bool {
+	rawSQL = strings.TrimSpace(rawSQL)
+	if len(rawSQL) < 6 || !strings.EqualFold(rawSQL[:6], "select") {
+		return false
+	}
+
+	return !lockingSQLRe.MatchString(rawSQL)
+}
+
+func (r *replicaRouter) pick() *sql.DB {
+	if r.policy == ReplicaPolicyRandom {
+		return r.replicas[rand.Intn(len(r.replicas))] //nolint:gosec
+	}
+
+	return r.replicas[(r.next.Add(1)-1)%uint64(len(r.replicas))]
+}
+
+func (r *replicaRouter) close() {
+	for _, replica := range r.replicas {
+		_ = replica.Close() //nolint:errcheck
+	}
+}
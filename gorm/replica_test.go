@@ -0,0 +1,137 @@
+package gorm
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type rwRecord struct {
+	ID   int `gorm:"column:id;primaryKey"`
+	Name string
+}
+
+func (rwRecord) TableName() string {
+	return "rw_record"
+}
+
+// newReplicaEngine 创建主库及两个从库，每个库中写入一条以库名命名的记录
+func newReplicaEngine(t *testing.T, policy string) *Engine {
+	t.Helper()
+
+	conf := sqliteConfig(t, "primary.db")
+	dir := filepath.Dir(conf.Database)
+	conf.Replicas = []Replica{{Database: filepath.Join(dir, "replica1.db")}, {Database: filepath.Join(dir, "replica2.db")}}
+	conf.ReplicaPolicy = policy
+
+	for name, path := range map[string]string{"primary": conf.Database, "replica1": conf.Replicas[0].Database, "replica2": conf.Replicas[1].Database} {
+		db := NewEngine(&Config{Driver: "sqlite", Database: path})
+		require.NoError(t, db.GetDB().AutoMigrate(&rwRecord{}))
+		require.NoError(t, db.GetDB().Create(&rwRecord{ID: 1, Name: name}).Error)
+		require.NoError(t, db.Close())
+	}
+
+	return newTestEngine(t, conf)
+}
+
+func readName(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+
+	var rec rwRecord
+	require.NoError(t, db.First(&rec, 1).Error)
+
+	return rec.Name
+}
+
+func TestReplicaRouting(t *testing.T) {
+	db := newReplicaEngine(t, ReplicaPolicyRoundRobin)
+
+	// 轮询从库
+	require.Equal(t, "replica1", readName(t, db.Context(ctx)))
+	require.Equal(t, "replica2", readName(t, db.Context(ctx)))
+	require.Equal(t, "replica1", readName(t, db.Context(ctx)))
+
+	// 强制主库
+	require.Equal(t, "primary", readName(t, db.Context(WithPrimary(ctx))))
+
+	// 写入走主库
+	require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 2, Name: "new"}).Error)
+	var count int64
+	require.NoError(t, db.Context(WithPrimary(ctx)).Model(&rwRecord{}).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+
+	// 事务中读主库
+	require.NoError(t, db.Context(ctx).Transaction(func(tx *gorm.DB) error {
+		require.Equal(t, "primary", readName(t, tx))
+		return nil
+	}))
+
+	// 复用的Statement查询后切换回主库
+	query := db.GetDB().Model(&rwRecord{}).Where("id = ?", 1)
+	var rec rwRecord
+	require.NoError(t, query.Find(&rec).Error)
+	require.Equal(t, db.replicas.primary, query.Statement.ConnPool)
+}
+
+func TestReplicaRouteSkip(t *testing.T) {
+	db := newReplicaEngine(t, ReplicaPolicyRandom)
+	router := db.replicas
+
+	locking := db.GetDB().Session(&gorm.Session{}).Clauses(clause.Locking{Strength: "UPDATE"})
+	router.route(locking)
+	require.Equal(t, router.primary, locking.Statement.ConnPool)
+
+	forced := db.GetDB().WithContext(WithPrimary(context.Background()))
+	router.route(forced)
+	require.Equal(t, router.primary, forced.Statement.ConnPool)
+
+	plain := db.GetDB().Session(&gorm.Session{})
+	router.route(plain)
+	require.NotEqual(t, router.primary, plain.Statement.ConnPool)
+	router.restore(plain)
+	require.Equal(t, router.primary, plain.Statement.ConnPool)
+}
+
+func TestReplicaRawSQL(t *testing.T) {
+	db := newReplicaEngine(t, ReplicaPolicyRoundRobin)
+
+	// 原生SELECT走从库
+	var name string
+	require.NoError(t, db.Context(ctx).Raw("SELECT name FROM rw_record WHERE id = 1").Scan(&name).Error)
+	require.Equal(t, "replica1", name)
+
+	// Raw().Scan()执行的写入走主库
+	var id int
+	require.NoError(t, db.Context(ctx).Raw("INSERT INTO rw_record (id, name) VALUES (2, 'raw') RETURNING id").Scan(&id).Error)
+	require.Equal(t, 2, id)
+	var count int64
+	require.NoError(t, db.Context(WithPrimary(ctx)).Model(&rwRecord{}).Where("id = ?", 2).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+
+	// 加锁读取走主库
+	router := db.replicas
+	for _, rawSQL := range []string{
+		"SELECT * FROM rw_record WHERE id = 1 FOR UPDATE",
+		"select * from rw_record for share",
+		"SELECT * FROM rw_record LOCK IN SHARE MODE",
+		"UPDATE rw_record SET name = 'x' RETURNING id",
+	} {
+		locking := db.GetDB().Raw(rawSQL)
+		router.route(locking)
+		require.Equal(t, router.primary, locking.Statement.ConnPool, rawSQL)
+	}
+	plain := db.GetDB().Raw("  SELECT * FROM rw_record WHERE name = 'for'")
+	router.route(plain)
+	require.NotEqual(t, router.primary, plain.Statement.ConnPool)
+}
+
+func TestReplicaPolicyInvalid(t *testing.T) {
+	conf := sqliteConfig(t, "x.db")
+	conf.ReplicaPolicy = "nearest"
+	_, err := NewEngineE(conf)
+	require.Error(t, err)
+}
@@ -0,0 +1,251 @@
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/aixj1984/golibs/uuid"
+)
+
+/* 分表算法，由分表键的值计算表名后缀 */
+
+// Algorithm 是分表算法
+type Algorithm interface {
+	// Shard 返回分表键的值对应的表名后缀，如 _03
+	Shard(value interface{}) (string, error)
+	// Suffixes 返回所有分表的后缀，分表数量不固定时返回nil
+	Suffixes() []string
+}
+
+// suffixes 返回 _00 到 _{shards-1} 的后缀，宽度至少为2位
+func suffixes(shards int) []string {
+	if shards <= 0 {
+		return nil
+	}
+
+	list := make([]string, 0, shards)
+	for i := 0; i < shards; i++ {
+		list = append(list, shardSuffix(i, shards))
+	}
+
+	return list
+}
+
+func shardSuffix(index, shards int) string {
+	width := len(strconv.Itoa(shards - 1))
+	if width < 2 {
+		width = 2
+	}
+
+	return fmt.Sprintf("_%0*d", width, index)
+}
+
+// toInt64 将整数或整数字符串转为int64
+func toInt64(value interface{}) (int64, error) {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.String:
+		return strconv.ParseInt(rv.String(), 10, 64)
+	default:
+		return 0, fmt.Errorf("sharding: unsupported key type %T", value)
+	}
+}
+
+// validateShards 校验分表数量，Initialize时及计算分表时调用
+func validateShards(shards int) error {
+	if shards <= 0 {
+		return fmt.Errorf("sharding: shards must be positive, got %d", shards)
+	}
+
+	return nil
+}
+
+type modAlgorithm struct {
+	shards int
+}
+
+// Mod 按整数取模分表，共shards张表，如 orders_00..orders_63，负数按绝对值取模；
+// uuid 的 GenSnowflake 生成的ID低22位为节点及毫秒内的序列号，请求量低时几乎不变，取模会集中到同一张分表，应使用 Hash
+func Mod(shards int) Algorithm {
+	return modAlgorithm{shards: shards}
+}
+
+func (a modAlgorithm) validate() error {
+	return validateShards(a.shards)
+}
+
+func (a modAlgorithm) Shard(value interface{}) (string, error) {
+	if err := a.validate(); err != nil {
+		return "", err
+	}
+	n, err := toInt64(value)
+	if err != nil {
+		return "", err
+	}
+
+	// 在uint64上取绝对值，MinInt64不会溢出
+	u := uint64(n)
+	if n < 0 {
+		u = -u
+	}
+
+	return shardSuffix(int(u%uint64(a.shards)), a.shards), nil
+}
+
+func (a modAlgorithm) Suffixes() []string {
+	return suffixes(a.shards)
+}
+
+type hashAlgorithm struct {
+	shards int
+}
+
+// Hash 按fnv32a哈希取模分表，适用于字符串等非整数的分表键，以及低位几乎不变的雪花算法ID
+func Hash(shards int) Algorithm {
+	return hashAlgorithm{shards: shards}
+}
+
+func (a hashAlgorithm) validate() error {
+	return validateShards(a.shards)
+}
+
+func (a hashAlgorithm) Shard(value interface{}) (string, error) {
+	if err := a.validate(); err != nil {
+		return "", err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	if !rv.IsValid() {
+		return "", fmt.Errorf("sharding: nil key")
+	}
+
+	h := fnv.New32a()
+	_, _ = fmt.Fprint(h, rv.Interface()) //nolint:errcheck
+
+	return shardSuffix(int(h.Sum32()%uint32(a.shards)), a.shards), nil
+}
+
+func (a hashAlgorithm) Suffixes() []string {
+	return suffixes(a.shards)
+}
+
+// DateUnit 是按日期分表的周期
+type DateUnit int
+
+const (
+	// Yearly 按年分表，后缀如 _2024
+	Yearly DateUnit = iota
+	// Monthly 按月分表，后缀如 _202401
+	Monthly
+	// Daily 按天分表，后缀如 _20240101
+	Daily
+)
+
+func (u DateUnit) layout() string {
+	switch u {
+	case Yearly:
+		return "_2006"
+	case Daily:
+		return "_20060102"
+	default:
+		return "_200601"
+	}
+}
+
+// next 返回下一个周期的开始时间
+func (u DateUnit) next(t time.Time) time.Time {
+	switch u {
+	case Yearly:
+		return t.AddDate(1, 0, 0)
+	case Daily:
+		return t.AddDate(0, 0, 1)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// truncate 返回周期的开始时间
+func (u DateUnit) truncate(t time.Time) time.Time {
+	switch u {
+	case Yearly:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+type dateAlgorithm struct {
+	unit     DateUnit
+	from, to time.Time
+	loc      *time.Location
+}
+
+// Date 按日期分表，分表键可以是time.Time、RFC3339或2006-01-02格式的字符串，
+// 或 uuid 的 GenSnowflake 生成的ID（使用ID中的时间）；
+// from、to不为零时，超出范围的值返回错误，Suffixes返回范围内的所有分表
+func Date(unit DateUnit, from, to time.Time) Algorithm {
+	loc := time.Local
+	if !from.IsZero() {
+		loc = from.Location()
+	}
+
+	return dateAlgorithm{unit: unit, from: from, to: to, loc: loc}
+}
+
+func (a dateAlgorithm) Shard(value interface{}) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	t = t.In(a.loc)
+	// to所在的整个周期都在范围内，与Suffixes一致
+	if (!a.from.IsZero() && t.Before(a.unit.truncate(a.from))) || (!a.to.IsZero() && !t.Before(a.unit.next(a.unit.truncate(a.to)))) {
+		return "", fmt.Errorf("sharding: %s out of range", t.Format(time.RFC3339))
+	}
+
+	return t.Format(a.unit.layout()), nil
+}
+
+func (a dateAlgorithm) Suffixes() []string {
+	if a.from.IsZero() || a.to.IsZero() {
+		return nil
+	}
+
+	var list []string
+	for t := a.unit.truncate(a.from); !t.After(a.to); t = a.unit.next(t) {
+		list = append(list, t.Format(a.unit.layout()))
+	}
+
+	return list
+}
+
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t, nil
+			}
+		}
+	default:
+		if id, err := toInt64(value); err == nil {
+			return uuid.SnowflakeTime(id), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("sharding: unsupported date key %v", value)
+}
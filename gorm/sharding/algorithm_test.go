@@ -0,0 +1,125 @@
+package sharding
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aixj1984/golibs/uuid"
+	require "github.com/stretchr/testify/require"
+)
+
+func TestMod(t *testing.T) {
+	alg := Mod(64)
+	suffixes := alg.Suffixes()
+	require.Len(t, suffixes, 64)
+	require.Equal(t, "_00", suffixes[0])
+	require.Equal(t, "_63", suffixes[63])
+
+	for value, want := range map[interface{}]string{
+		int64(65): "_01", 3: "_03", 5: "_05", uint8(64): "_00", "130": "_02", -1: "_01", int64(math.MinInt64): "_00",
+	} {
+		suffix, err := alg.Shard(value)
+		require.NoError(t, err)
+		require.Equal(t, want, suffix, value)
+	}
+	id := int64(7)
+	suffix, err := alg.Shard(&id)
+	require.NoError(t, err)
+	require.Equal(t, "_07", suffix)
+
+	_, err = alg.Shard("abc")
+	require.Error(t, err)
+	_, err = alg.Shard(1.5)
+	require.Error(t, err)
+
+	require.Equal(t, "_999", Mod(1000).Suffixes()[999])
+
+	for _, shards := range []int{0, -1} {
+		_, err = Mod(shards).Shard(1)
+		require.Error(t, err)
+		_, err = Hash(shards).Shard("a")
+		require.Error(t, err)
+		require.Empty(t, Mod(shards).Suffixes())
+	}
+}
+
+func TestHashSnowflakeSpread(t *testing.T) {
+	// 请求量低时每个ID的毫秒内序列号都为0，Mod会集中到同一张分表
+	uid, err := uuid.NewWithNode(1)
+	require.NoError(t, err)
+	alg := Hash(4)
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		time.Sleep(time.Millisecond)
+		suffix, err := alg.Shard(uid.GenSnowflake())
+		require.NoError(t, err)
+		counts[suffix]++
+	}
+	for _, suffix := range alg.Suffixes() {
+		require.GreaterOrEqual(t, counts[suffix], 10, counts)
+	}
+}
+
+func TestHash(t *testing.T) {
+	alg := Hash(8)
+	first, err := alg.Shard("user-1")
+	require.NoError(t, err)
+	require.Contains(t, alg.Suffixes(), first)
+
+	for i := 0; i < 10; i++ {
+		suffix, err := alg.Shard("user-1")
+		require.NoError(t, err)
+		require.Equal(t, first, suffix)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		suffix, err := alg.Shard(i)
+		require.NoError(t, err)
+		seen[suffix] = true
+	}
+	require.Len(t, seen, 8)
+
+	_, err = alg.Shard(nil)
+	require.Error(t, err)
+}
+
+func TestDate(t *testing.T) {
+	from := time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)
+	alg := Date(Monthly, from, to)
+	require.Equal(t, []string{"_202401", "_202402", "_202403", "_202404"}, alg.Suffixes())
+
+	suffix, err := alg.Shard(time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local))
+	require.NoError(t, err)
+	require.Equal(t, "_202401", suffix)
+
+	suffix, err = alg.Shard("2024-03-31")
+	require.NoError(t, err)
+	require.Equal(t, "_202403", suffix)
+
+	_, err = alg.Shard("2023-12-31")
+	require.Error(t, err)
+	// to所在月份的其他时间也在范围内
+	suffix, err = alg.Shard(time.Date(2024, 4, 30, 23, 59, 0, 0, time.Local))
+	require.NoError(t, err)
+	require.Equal(t, "_202404", suffix)
+	_, err = alg.Shard(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local))
+	require.Error(t, err)
+	_, err = alg.Shard("yesterday")
+	require.Error(t, err)
+
+	// 雪花算法ID使用其中的时间
+	uid, err := uuid.NewWithNode(1)
+	require.NoError(t, err)
+	daily := Date(Daily, time.Time{}, time.Time{})
+	require.Nil(t, daily.Suffixes())
+	suffix, err = daily.Shard(uid.GenSnowflake())
+	require.NoError(t, err)
+	require.Equal(t, time.Now().Format("_20060102"), suffix)
+
+	suffix, err = Date(Yearly, time.Time{}, time.Time{}).Shard(from)
+	require.NoError(t, err)
+	require.Equal(t, "_2024", suffix)
+}
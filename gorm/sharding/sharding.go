@@ -0,0 +1,351 @@
+package sharding
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/* 按分表键将逻辑表改写为分表的gorm插件 */
+
+var (
+	// ErrMissingShardingKey 是条件或模型中没有分表键
+	ErrMissingShardingKey = errors.New("sharding: missing sharding key")
+	// ErrCrossShard 是分表键的值分布在多张分表中
+	ErrCrossShard = errors.New("sharding: values span multiple shards")
+	// ErrNoSuffixes 是分表算法的分表数量不固定，无法遍历所有分表
+	ErrNoSuffixes = errors.New("sharding: algorithm has no fixed shards")
+)
+
+// Rule 是一张逻辑表的分表规则
+type Rule struct {
+	// Table 是逻辑表名，如 orders
+	Table string
+	// Key 是分表键的列名，如 user_id
+	Key string
+	// Algorithm 是分表算法
+	Algorithm Algorithm
+	// IDGenerator 不为nil时，创建记录前为零值的主键生成ID，如 uuid.New().GenSnowflake
+	IDGenerator func() int64
+}
+
+// Sharding 是分表插件，从条件中取分表键的值将逻辑表改写为分表，创建、更新、删除时也从模型中取；
+// 没有分表键时返回 ErrMissingShardingKey，需要操作所有分表时使用 ForEachShard。
+// Raw、Exec执行的SQL及条件中带逻辑表名的列（如 orders.user_id）不会改写
+type Sharding struct {
+	rules map[string]*Rule
+}
+
+// New 创建分表插件，通过 db.Use 注册
+func New(rules ...Rule) *Sharding {
+	s := &Sharding{rules: make(map[string]*Rule, len(rules))}
+	for i := range rules {
+		s.rules[rules[i].Table] = &rules[i]
+	}
+
+	return s
+}
+
+// Name 实现gorm.Plugin
+func (s *Sharding) Name() string {
+	return "gorm:sharding"
+}
+
+// Initialize 实现gorm.Plugin
+func (s *Sharding) Initialize(db *gorm.DB) error {
+	for _, rule := range s.rules {
+		if rule.Table == "" || rule.Key == "" || rule.Algorithm == nil {
+			return fmt.Errorf("sharding: invalid rule for table %q", rule.Table)
+		}
+		if v, ok := rule.Algorithm.(interface{ validate() error }); ok {
+			if err := v.validate(); err != nil {
+				return fmt.Errorf("sharding: invalid rule for table %q: %w", rule.Table, err)
+			}
+		}
+	}
+
+	callback := db.Callback()
+	if err := callback.Create().Before("gorm:create").Register("sharding:create", s.routeCreate); err != nil {
+		return err
+	}
+	if err := callback.Query().Before("gorm:query").Register("sharding:query", s.routeQuery); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("sharding:update", s.route); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("sharding:delete", s.route); err != nil {
+		return err
+	}
+
+	return callback.Row().Before("gorm:row").Register("sharding:row", s.routeQuery)
+}
+
+// Table 返回逻辑表中分表键的值对应的分表名，table没有分表规则时原样返回
+func (s *Sharding) Table(table string, value interface{}) (string, error) {
+	rule, ok := s.rules[table]
+	if !ok {
+		return table, nil
+	}
+	suffix, err := rule.Algorithm.Shard(value)
+	if err != nil {
+		return "", err
+	}
+
+	return table + suffix, nil
+}
+
+// ForEachShard 依次在逻辑表的每张分表上执行fn，tx已设置为分表，shard为分表名
+func (s *Sharding) ForEachShard(db *gorm.DB, table string, fn func(tx *gorm.DB, shard string) error) error {
+	rule, ok := s.rules[table]
+	if !ok {
+		return fmt.Errorf("sharding: no rule for table %q", table)
+	}
+	list := rule.Algorithm.Suffixes()
+	if list == nil {
+		return fmt.Errorf("%w: %s", ErrNoSuffixes, table)
+	}
+
+	for _, suffix := range list {
+		shard := table + suffix
+		if err := fn(db.Table(shard), shard); err != nil {
+			return fmt.Errorf("sharding: %s: %w", shard, err)
+		}
+	}
+
+	return nil
+}
+
+// routeCreate 按需生成主键后改写为分表
+func (s *Sharding) routeCreate(db *gorm.DB) {
+	stmt := db.Statement
+	if rule, ok := s.rules[stmt.Table]; ok && db.Error == nil && rule.IDGenerator != nil && stmt.Schema != nil {
+		generateIDs(stmt, rule.IDGenerator)
+	}
+
+	s.route(db)
+}
+
+// routeQuery 只从条件中取分表键，查询的目标不作为分表键的来源
+func (s *Sharding) routeQuery(db *gorm.DB) {
+	s.routeBy(db, false)
+}
+
+// route 从条件或模型中取分表键
+func (s *Sharding) route(db *gorm.DB) {
+	s.routeBy(db, true)
+}
+
+// routeBy 将逻辑表改写为分表
+func (s *Sharding) routeBy(db *gorm.DB, useModel bool) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Table == "" {
+		return
+	}
+	rule, ok := s.rules[stmt.Table]
+	if !ok {
+		return
+	}
+
+	values, found := keyFromWhere(stmt, rule.Key)
+	if !found && useModel {
+		values, found = keyFromModel(stmt, rule.Key)
+	}
+	if !found {
+		_ = db.AddError(fmt.Errorf("%w: %s.%s", ErrMissingShardingKey, rule.Table, rule.Key)) //nolint:errcheck
+		return
+	}
+
+	suffix := ""
+	for i, value := range values {
+		next, err := rule.Algorithm.Shard(value)
+		if err != nil {
+			_ = db.AddError(err) //nolint:errcheck
+			return
+		}
+		if i > 0 && next != suffix {
+			_ = db.AddError(fmt.Errorf("%w: %s%s, %s%s", ErrCrossShard, rule.Table, suffix, rule.Table, next)) //nolint:errcheck
+			return
+		}
+		suffix = next
+	}
+
+	stmt.Table = rule.Table + suffix
+	if stmt.TableExpr != nil {
+		stmt.TableExpr = &clause.Expr{SQL: stmt.Quote(stmt.Table)}
+	}
+}
+
+// generateIDs 为零值的主键生成ID
+func generateIDs(stmt *gorm.Statement, gen func() int64) {
+	field := stmt.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return
+	}
+	switch field.FieldType.Kind() {
+	case reflect.Int64, reflect.Uint64:
+	default:
+		return
+	}
+
+	eachRecord(stmt.ReflectValue, func(rv reflect.Value) {
+		if _, zero := field.ValueOf(stmt.Context, rv); zero {
+			_ = field.Set(stmt.Context, rv, gen()) //nolint:errcheck
+		}
+	})
+}
+
+// keyFromModel 从创建的记录或更新、删除的模型中取分表键的值，零值视为没有
+func keyFromModel(stmt *gorm.Statement, key string) ([]interface{}, bool) {
+	if stmt.Schema == nil || !stmt.ReflectValue.IsValid() {
+		return nil, false
+	}
+	field := stmt.Schema.LookUpField(key)
+	if field == nil {
+		return nil, false
+	}
+
+	var values []interface{}
+	missing := false
+	eachRecord(stmt.ReflectValue, func(rv reflect.Value) {
+		value, zero := field.ValueOf(stmt.Context, rv)
+		if zero {
+			missing = true
+			return
+		}
+		values = append(values, value)
+	})
+
+	return values, len(values) > 0 && !missing
+}
+
+// eachRecord 遍历结构体或切片中的每条记录
+func eachRecord(rv reflect.Value, fn func(reflect.Value)) {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if elem.Kind() == reflect.Struct {
+				fn(elem)
+			}
+		}
+	case reflect.Struct:
+		fn(rv)
+	}
+}
+
+// keyFromWhere 从WHERE条件中取分表键的值，只识别以AND连接的 key = ?、key IN ? 条件
+func keyFromWhere(stmt *gorm.Statement, key string) ([]interface{}, bool) {
+	c, ok := stmt.Clauses["WHERE"]
+	if !ok {
+		return nil, false
+	}
+	where, ok := c.Expression.(clause.Where)
+	if !ok {
+		return nil, false
+	}
+
+	// 顶层有OR条件时分表键的条件不一定成立
+	for _, expr := range where.Exprs {
+		if _, ok := expr.(clause.OrConditions); ok {
+			return nil, false
+		}
+	}
+
+	return keyFromExprs(where.Exprs, key)
+}
+
+func keyFromExprs(exprs []clause.Expression, key string) ([]interface{}, bool) {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if columnIs(e.Column, key) && e.Value != nil {
+				return []interface{}{e.Value}, true
+			}
+		case clause.IN:
+			if columnIs(e.Column, key) && len(e.Values) > 0 {
+				return e.Values, true
+			}
+		case clause.Expr:
+			if values, ok := keyFromExpr(e, key); ok {
+				return values, true
+			}
+		case clause.AndConditions:
+			if values, ok := keyFromExprs(e.Exprs, key); ok {
+				return values, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// keyFromExpr 识别字符串条件中以AND连接的 key = ? 及 key IN ?
+func keyFromExpr(e clause.Expr, key string) ([]interface{}, bool) {
+	if orRe.MatchString(e.SQL) {
+		return nil, false
+	}
+
+	idx := 0
+	for _, part := range andRe.Split(e.SQL, -1) {
+		n := strings.Count(part, "?")
+		if n == 1 && idx < len(e.Vars) {
+			if match := keyExprRe.FindStringSubmatch(part); match != nil && strings.EqualFold(match[1], key) {
+				return keyValues(match[2], e.Vars[idx])
+			}
+		}
+		idx += n
+	}
+
+	return nil, false
+}
+
+// keyValues 返回 = 或 IN 条件中的值
+func keyValues(op string, v interface{}) ([]interface{}, bool) {
+	if op == "=" {
+		return []interface{}{v}, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Len() == 0 {
+		return nil, false
+	}
+	values := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values = append(values, rv.Index(i).Interface())
+	}
+
+	return values, true
+}
+
+var (
+	andRe = regexp.MustCompile(`(?i)\s+AND\s+`)
+	orRe  = regexp.MustCompile(`(?i)\bOR\b`)
+)
+
+// keyExprRe 匹配 user_id = ?、`orders`.`user_id` IN (?) 等条件
+var keyExprRe = regexp.MustCompile("(?i)^\\s*(?:[`\"]?\\w+[`\"]?\\.)?[`\"]?(\\w+)[`\"]?\\s*(=|IN)\\s*\\(?\\s*\\?\\s*\\)?\\s*$")
+
+// columnIs 判断条件的列是否为分表键
+func columnIs(column interface{}, key string) bool {
+	switch c := column.(type) {
+	case clause.Column:
+		return c.Name == key
+	case string:
+		name := c
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		return strings.Trim(name, "`\"") == key
+	default:
+		return false
+	}
+}
+
+var _ gorm.Plugin = (*Sharding)(nil)
@@ -0,0 +1,167 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aixj1984/golibs/gorm"
+	"github.com/aixj1984/golibs/gorm/internal/gormtest"
+	"github.com/aixj1984/golibs/uuid"
+	require "github.com/stretchr/testify/require"
+	gormio "gorm.io/gorm"
+)
+
+var ctx = context.Background()
+
+type order struct {
+	ID     int64
+	UserID int64
+	Amount int
+}
+
+func (order) TableName() string {
+	return "orders"
+}
+
+func newShardedEngine(t *testing.T) (*gorm.Engine, *Sharding) {
+	t.Helper()
+
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "sharding.db"))
+
+	uid, err := uuid.NewWithNode(1)
+	require.NoError(t, err)
+	plugin := New(Rule{Table: "orders", Key: "user_id", Algorithm: Mod(4), IDGenerator: uid.GenSnowflake})
+	require.NoError(t, db.GetDB().Use(plugin))
+
+	require.NoError(t, plugin.ForEachShard(db.Context(ctx), "orders", func(tx *gormio.DB, _ string) error {
+		return tx.AutoMigrate(&order{})
+	}))
+
+	return db, plugin
+}
+
+// shardCount 直接统计分表中的记录数
+func shardCount(t *testing.T, db *gorm.Engine, shard string) int64 {
+	t.Helper()
+
+	var count int64
+	require.NoError(t, db.Context(ctx).Raw("SELECT COUNT(*) FROM "+shard).Scan(&count).Error)
+
+	return count
+}
+
+func TestShardingCreate(t *testing.T) {
+	db, _ := newShardedEngine(t)
+
+	o := &order{UserID: 5, Amount: 1}
+	require.NoError(t, db.Context(ctx).Create(o).Error)
+	require.NotZero(t, o.ID)
+	require.Equal(t, int64(1), uuid.SnowflakeNode(o.ID))
+	require.Equal(t, int64(1), shardCount(t, db, "orders_01"))
+
+	// 同一分表的批量创建
+	orders := []*order{{UserID: 1}, {UserID: 9}}
+	require.NoError(t, db.Context(ctx).Create(&orders).Error)
+	require.NotEqual(t, orders[0].ID, orders[1].ID)
+	require.Equal(t, int64(3), shardCount(t, db, "orders_01"))
+
+	err := db.Context(ctx).Create([]*order{{UserID: 1}, {UserID: 2}}).Error
+	require.True(t, errors.Is(err, ErrCrossShard))
+	err = db.Context(ctx).Create(&order{Amount: 1}).Error
+	require.True(t, errors.Is(err, ErrMissingShardingKey))
+
+	// 指定的主键不会被覆盖
+	require.NoError(t, db.Context(ctx).Create(&order{ID: 42, UserID: 2}).Error)
+	var got order
+	require.NoError(t, db.Context(ctx).Where("user_id = ?", 2).First(&got).Error)
+	require.Equal(t, int64(42), got.ID)
+}
+
+func TestShardingQuery(t *testing.T) {
+	db, plugin := newShardedEngine(t)
+	for _, userID := range []int64{1, 2, 3, 5, 6} {
+		require.NoError(t, db.Context(ctx).Create(&order{UserID: userID, Amount: int(userID)}).Error)
+	}
+
+	var orders []order
+	require.NoError(t, db.Context(ctx).Where("user_id = ?", 5).Find(&orders).Error)
+	require.Len(t, orders, 1)
+	require.Equal(t, 5, orders[0].Amount)
+
+	require.NoError(t, db.Context(ctx).Where(&order{UserID: 2}).Find(&orders).Error)
+	require.Len(t, orders, 1)
+	require.Equal(t, 2, orders[0].Amount)
+
+	require.NoError(t, db.Context(ctx).Where("`user_id` IN (?)", []int64{1, 5}).Order("user_id").Find(&orders).Error)
+	require.Len(t, orders, 2)
+
+	require.NoError(t, db.Context(ctx).Find(&orders, "user_id = ? AND amount > ?", 6, 0).Error)
+	require.Len(t, orders, 1)
+
+	var count int64
+	require.NoError(t, db.Context(ctx).Model(&order{}).Where(map[string]interface{}{"user_id": 3}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+
+	for _, tx := range []*gormio.DB{
+		db.Context(ctx).Where("amount = ?", 1),
+		db.Context(ctx).Where("user_id = ?", 1).Or("amount = ?", 2),
+		db.Context(ctx).Where("user_id > ?", 1),
+	} {
+		err := tx.Find(&orders).Error
+		require.True(t, errors.Is(err, ErrMissingShardingKey), err)
+	}
+	err := db.Context(ctx).Where("user_id IN ?", []int64{1, 2}).Find(&orders).Error
+	require.True(t, errors.Is(err, ErrCrossShard))
+
+	// 遍历所有分表
+	total := 0
+	require.NoError(t, plugin.ForEachShard(db.Context(ctx), "orders", func(tx *gormio.DB, shard string) error {
+		var list []order
+		if err := tx.Find(&list).Error; err != nil {
+			return err
+		}
+		total += len(list)
+		return nil
+	}))
+	require.Equal(t, 5, total)
+
+	table, err := plugin.Table("orders", 6)
+	require.NoError(t, err)
+	require.Equal(t, "orders_02", table)
+	table, err = plugin.Table("users", 6)
+	require.NoError(t, err)
+	require.Equal(t, "users", table)
+}
+
+func TestShardingUpdateDelete(t *testing.T) {
+	db, _ := newShardedEngine(t)
+	o := &order{UserID: 3, Amount: 1}
+	require.NoError(t, db.Context(ctx).Create(o).Error)
+
+	require.NoError(t, db.Context(ctx).Model(&order{}).Where("user_id = ?", 3).Update("amount", 10).Error)
+	o.Amount = 20
+	require.NoError(t, db.Context(ctx).Save(o).Error)
+
+	var got order
+	require.NoError(t, db.Context(ctx).Where("user_id = ? AND id = ?", 3, o.ID).Take(&got).Error)
+	require.Equal(t, 20, got.Amount)
+
+	err := db.Context(ctx).Model(&order{}).Where("id = ?", o.ID).Update("amount", 1).Error
+	require.True(t, errors.Is(err, ErrMissingShardingKey))
+
+	require.Equal(t, int64(1), shardCount(t, db, "orders_03"))
+	require.NoError(t, db.Context(ctx).Delete(o).Error)
+	require.Zero(t, shardCount(t, db, "orders_03"))
+}
+
+func TestInvalidRule(t *testing.T) {
+	db := gormtest.NewEngine(t, gormtest.SQLiteConfig(t, "invalid.db"))
+
+	require.Error(t, db.GetDB().Use(New(Rule{Table: "orders", Key: "user_id"})))
+	require.Error(t, db.GetDB().Use(New(Rule{Table: "orders", Key: "user_id", Algorithm: Mod(0)})))
+	err := New(Rule{Table: "logs", Key: "day", Algorithm: Date(Daily, time.Time{}, time.Time{})}).
+		ForEachShard(db.GetDB(), "logs", func(*gormio.DB, string) error { return nil })
+	require.True(t, errors.Is(err, ErrNoSuffixes))
+}
@@ -0,0 +1,402 @@
+package gorm
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aixj1984/golibs/zlog"
+	"gorm.io/gorm"
+)
+
+/* 多租户，按上下文中的租户ID路由到租户的DB实例 */
+
+const (
+	// TenantModeDatabase 每个租户使用单独的数据库
+	TenantModeDatabase = "database"
+	// TenantModeSchema 每个租户使用同一数据库中单独的schema，通过search_path隔离，仅支持postgres
+	TenantModeSchema = "schema"
+
+	defaultTenantPattern    = "%s"
+	defaultTenantMaxEngines = 64
+	defaultTenantCloseGrace = 30 * time.Second
+)
+
+var (
+	// ErrTenantRequired 是上下文中没有租户
+	ErrTenantRequired = errors.New("tenant required")
+	// ErrTenantMismatch 是上下文中的租户与DB实例的租户不一致
+	ErrTenantMismatch = errors.New("tenant mismatch")
+	// ErrInvalidTenant 是租户ID不合法
+	ErrInvalidTenant = errors.New("invalid tenant id")
+	// ErrTenantRouterClosed 是多租户路由已关闭
+	ErrTenantRouterClosed = errors.New("tenant router closed")
+)
+
+// tenantIDRe 限制租户ID只能使用字母、数字及下划线，避免拼接到库名中产生注入
+var tenantIDRe = regexp.MustCompile(`^[A-Za-z0-9_]{1,63}$`)
+
+type tenantCtxKey struct{}
+
+// WithTenant 将租户ID保存到上下文中
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFromContext 返回上下文中的租户ID
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenant, ok := ctx.Value(tenantCtxKey{}).(string)
+
+	return tenant, ok && tenant != ""
+}
+
+// TenantConfig 是多租户的配置
+type TenantConfig struct {
+	Template    Config        `mapstructure:"template" json:"template" yaml:"template" comment:"租户DB的配置模板"`
+	Mode        string        `mapstructure:"mode" json:"mode" yaml:"mode" comment:"租户隔离方式 database schema，默认database"`
+	Pattern     string        `mapstructure:"pattern" json:"pattern" yaml:"pattern" comment:"由租户ID生成库名或schema名的格式，如 tenant_%s，默认%s"`
+	MaxEngines  int           `mapstructure:"maxEngines" json:"maxEngines" yaml:"maxEngines" comment:"最多同时打开的租户DB数，超过时关闭最久未使用的，默认64"`
+	IdleTimeout time.Duration `mapstructure:"idleTimeout" json:"idleTimeout" yaml:"idleTimeout" comment:"租户DB空闲多久后关闭，0为不关闭"`
+	CloseGrace  time.Duration `mapstructure:"closeGrace" json:"closeGrace" yaml:"closeGrace" comment:"租户DB被淘汰后延迟关闭的时间，默认30s"`
+}
+
+// tenantEngine 是LRU中的一个租户DB实例，engine在ready关闭后可用，创建失败时err不为空
+type tenantEngine struct {
+	tenant   string
+	engine   *Engine
+	err      error
+	ready    chan struct{}
+	lastUsed time.Time
+}
+
+// TenantRouter 按上下文中的租户ID路由到租户的DB实例，实例在首次使用时按模板创建，
+// 超过MaxEngines或空闲超过IdleTimeout的实例会被淘汰，淘汰的实例在CloseGrace后关闭，
+// 因此不要长期持有返回的Engine
+type TenantRouter struct {
+	conf TenantConfig
+
+	mu      sync.Mutex
+	engines map[string]*list.Element
+	lru     *list.List
+	// retiring 是被淘汰后等待关闭的实例
+	retiring map[*Engine]*time.Timer
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewTenantRouter 创建一个多租户路由
+func NewTenantRouter(conf *TenantConfig) (*TenantRouter, error) {
+	c := *conf
+	if c.Mode == "" {
+		c.Mode = TenantModeDatabase
+	}
+	if c.Mode != TenantModeDatabase && c.Mode != TenantModeSchema {
+		return nil, fmt.Errorf("invalid tenant mode %q", c.Mode)
+	}
+	// 其他驱动没有能隔离所有表的方式，表名前缀对实现了TableName()的模型不生效，会读写到其他租户的数据
+	if c.Mode == TenantModeSchema && c.Template.Driver != "postgres" {
+		return nil, fmt.Errorf("tenant mode %q is only supported by postgres, got %q", c.Mode, c.Template.Driver)
+	}
+	// 从库的DSN无法按租户改写
+	for _, replica := range c.Template.Replicas {
+		if replica.DSN != "" {
+			return nil, errors.New("tenant template replicas must not use dsn")
+		}
+	}
+	if c.Pattern == "" {
+		c.Pattern = defaultTenantPattern
+	}
+	if !strings.Contains(c.Pattern, "%s") {
+		return nil, fmt.Errorf("tenant pattern %q must contain %%s", c.Pattern)
+	}
+	if c.MaxEngines <= 0 {
+		c.MaxEngines = defaultTenantMaxEngines
+	}
+	if c.CloseGrace <= 0 {
+		c.CloseGrace = defaultTenantCloseGrace
+	}
+
+	r := &TenantRouter{
+		conf:     c,
+		engines:  make(map[string]*list.Element),
+		lru:      list.New(),
+		retiring: make(map[*Engine]*time.Timer),
+		stop:     make(chan struct{}),
+	}
+	if c.IdleTimeout > 0 {
+		go r.evictLoop()
+	}
+
+	return r, nil
+}
+
+// DB 返回在上下文中租户的DB实例上执行的DB，上下文中没有租户时返回 ErrTenantRequired
+func (r *TenantRouter) DB(ctx context.Context) (*gorm.DB, error) {
+	engine, err := r.Engine(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.Context(ctx), nil
+}
+
+// Engine 返回上下文中租户的DB实例
+func (r *TenantRouter) Engine(ctx context.Context) (*Engine, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrTenantRequired
+	}
+
+	return r.EngineFor(tenant)
+}
+
+// EngineFor 返回租户的DB实例，不存在时按模板创建
+func (r *TenantRouter) EngineFor(tenant string) (*Engine, error) {
+	if !tenantIDRe.MatchString(tenant) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTenant, tenant)
+	}
+
+	r.mu.Lock()
+	if r.closed() {
+		r.mu.Unlock()
+		return nil, ErrTenantRouterClosed
+	}
+
+	if elem, ok := r.engines[tenant]; ok {
+		te := elem.Value.(*tenantEngine)
+		te.lastUsed = time.Now()
+		r.lru.MoveToFront(elem)
+		r.mu.Unlock()
+
+		// 其他调用正在创建时等待其完成
+		<-te.ready
+		if te.err != nil {
+			return nil, te.err
+		}
+		return te.engine, nil
+	}
+
+	te := &tenantEngine{tenant: tenant, ready: make(chan struct{}), lastUsed: time.Now()}
+	elem := r.lru.PushFront(te)
+	r.engines[tenant] = elem
+	r.mu.Unlock()
+
+	// 创建连接时不持有锁，不阻塞其他租户，同一租户的调用等待ready
+	engine, err := NewEngineE(r.tenantConfig(tenant))
+	if err == nil {
+		addTenantGuard(engine.gorm, tenant)
+	}
+
+	r.mu.Lock()
+	closed := r.closed()
+	if err == nil && closed {
+		// 创建期间路由被关闭
+		err = ErrTenantRouterClosed
+	} else if err == nil {
+		te.engine = engine
+	}
+	te.err = err
+	close(te.ready)
+	if err != nil {
+		r.remove(elem)
+	} else {
+		r.evictOverflow()
+	}
+	r.mu.Unlock()
+
+	if closed && engine != nil {
+		engine.Close() //nolint:errcheck,gosec
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return engine, nil
+}
+
+func (r *TenantRouter) closed() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// tenantConfig 按模板生成租户的配置
+func (r *TenantRouter) tenantConfig(tenant string) *Config {
+	conf := r.conf.Template
+	name := fmt.Sprintf(r.conf.Pattern, tenant)
+	conf.Alias = "tenant:" + tenant
+
+	if r.conf.Mode == TenantModeDatabase {
+		conf.Database = name
+		// 从库使用同名的租户库
+		conf.Replicas = make([]Replica, len(r.conf.Template.Replicas))
+		for i, replica := range r.conf.Template.Replicas {
+			replica.Database = name
+			conf.Replicas[i] = replica
+		}
+		return &conf
+	}
+
+	// 从库的配置复制自主库，同样设置search_path
+	params := make(map[string]string, len(conf.Params)+1)
+	for k, v := range conf.Params {
+		params[k] = v
+	}
+	params["search_path"] = name
+	conf.Params = params
+
+	return &conf
+}
+
+// remove 从LRU中移除一个租户，需在持有锁时调用，Close后元素已不在LRU中
+func (r *TenantRouter) remove(elem *list.Element) {
+	te := elem.Value.(*tenantEngine)
+	if r.engines[te.tenant] != elem {
+		return
+	}
+	r.lru.Remove(elem)
+	delete(r.engines, te.tenant)
+}
+
+// evictOverflow 淘汰超过MaxEngines的最久未使用的实例，正在创建的实例不淘汰，需在持有锁时调用
+func (r *TenantRouter) evictOverflow() {
+	for elem := r.lru.Back(); elem != nil && r.lru.Len() > r.conf.MaxEngines; {
+		prev := elem.Prev()
+		if elem.Value.(*tenantEngine).engine != nil {
+			r.evict(elem, "capacity")
+		}
+		elem = prev
+	}
+}
+
+// evict 移除一个租户DB实例并在CloseGrace后关闭，已取得实例的调用在此期间仍可使用，需在持有锁时调用
+func (r *TenantRouter) evict(elem *list.Element, reason string) {
+	te := elem.Value.(*tenantEngine)
+	r.remove(elem)
+
+	engine := te.engine
+	r.retiring[engine] = time.AfterFunc(r.conf.CloseGrace, func() {
+		r.mu.Lock()
+		delete(r.retiring, engine)
+		r.mu.Unlock()
+
+		if err := engine.Close(); err != nil {
+			zlog.Warn("tenant db close failed", zlog.Fields{"tenant": te.tenant, "error": err.Error()})
+		}
+	})
+	zlog.Info("tenant db evicted", zlog.Fields{"tenant": te.tenant, "reason": reason})
+}
+
+// evictIdle 关闭空闲超过IdleTimeout的租户DB实例
+func (r *TenantRouter) evictIdle() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deadline := time.Now().Add(-r.conf.IdleTimeout)
+	for elem := r.lru.Back(); elem != nil; {
+		te := elem.Value.(*tenantEngine)
+		if te.lastUsed.After(deadline) {
+			return
+		}
+		prev := elem.Prev()
+		if te.engine != nil {
+			r.evict(elem, "idle")
+		}
+		elem = prev
+	}
+}
+
+func (r *TenantRouter) evictLoop() {
+	interval := r.conf.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.evictIdle()
+		}
+	}
+}
+
+// Tenants 返回当前打开的租户，按最近使用排序
+func (r *TenantRouter) Tenants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenants := make([]string, 0, r.lru.Len())
+	for elem := r.lru.Front(); elem != nil; elem = elem.Next() {
+		tenants = append(tenants, elem.Value.(*tenantEngine).tenant)
+	}
+
+	return tenants
+}
+
+// Close 关闭所有租户DB实例，包括等待关闭的实例，正在创建的实例在创建完成后关闭
+func (r *TenantRouter) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	r.mu.Lock()
+	all := make(map[*Engine]string, r.lru.Len()+len(r.retiring))
+	for elem := r.lru.Front(); elem != nil; elem = elem.Next() {
+		if te := elem.Value.(*tenantEngine); te.engine != nil {
+			all[te.engine] = te.tenant
+		}
+	}
+	for engine, timer := range r.retiring {
+		if timer.Stop() {
+			all[engine] = strings.TrimPrefix(engine.conf.Alias, "tenant:")
+		}
+	}
+	r.engines = make(map[string]*list.Element)
+	r.lru = list.New()
+	r.retiring = make(map[*Engine]*time.Timer)
+	r.mu.Unlock()
+
+	var errs []error
+	for engine, tenant := range all {
+		if err := engine.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// addTenantGuard 注册回调，拒绝上下文中没有租户或租户不一致的操作
+func addTenantGuard(db *gorm.DB, tenant string) {
+	guard := func(scope *gorm.DB) {
+		ctxTenant, ok := TenantFromContext(scope.Statement.Context)
+		if !ok {
+			_ = scope.AddError(ErrTenantRequired) //nolint:errcheck
+			return
+		}
+		if ctxTenant != tenant {
+			_ = scope.AddError(fmt.Errorf("%w: %s, expect %s", ErrTenantMismatch, ctxTenant, tenant)) //nolint:errcheck
+		}
+	}
+
+	_ = db.Callback().Create().Before("gorm:create").Register("tenant:guard_create", guard) //nolint:errcheck
+	_ = db.Callback().Query().Before("gorm:query").Register("tenant:guard_query", guard)    //nolint:errcheck
+	_ = db.Callback().Update().Before("gorm:update").Register("tenant:guard_update", guard) //nolint:errcheck
+	_ = db.Callback().Delete().Before("gorm:delete").Register("tenant:guard_delete", guard) //nolint:errcheck
+	_ = db.Callback().Row().Before("gorm:row").Register("tenant:guard_row", guard)          //nolint:errcheck
+	_ = db.Callback().Raw().Before("gorm:raw").Register("tenant:guard_raw", guard)          //nolint:errcheck
+}
@@ -0,0 +1,213 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+func newTenantRouter(t *testing.T, conf TenantConfig) *TenantRouter {
+	t.Helper()
+
+	conf.Template = Config{Driver: "sqlite"}
+	conf.Pattern = filepath.Join(t.TempDir(), "tenant_%s.db")
+	r, err := NewTenantRouter(&conf)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = r.Close() }) //nolint:errcheck
+
+	return r
+}
+
+func TestTenantRouting(t *testing.T) {
+	r := newTenantRouter(t, TenantConfig{})
+
+	_, err := r.DB(ctx)
+	require.True(t, errors.Is(err, ErrTenantRequired))
+	_, err = r.DB(WithTenant(ctx, "a;drop database"))
+	require.True(t, errors.Is(err, ErrInvalidTenant))
+
+	ctxA, ctxB := WithTenant(ctx, "a"), WithTenant(ctx, "b")
+	for _, c := range []context.Context{ctxA, ctxB} {
+		db, err := r.DB(c)
+		require.NoError(t, err)
+		require.NoError(t, db.AutoMigrate(&rwRecord{}))
+	}
+
+	dbA, err := r.DB(ctxA)
+	require.NoError(t, err)
+	require.NoError(t, dbA.Create(&rwRecord{ID: 1, Name: "a"}).Error)
+
+	dbB, err := r.DB(ctxB)
+	require.NoError(t, err)
+	var count int64
+	require.NoError(t, dbB.Model(&rwRecord{}).Count(&count).Error)
+	require.Zero(t, count)
+
+	engineA, err := r.EngineFor("a")
+	require.NoError(t, err)
+	sameA, err := r.Engine(ctxA)
+	require.NoError(t, err)
+	require.Same(t, engineA, sameA)
+	require.Equal(t, []string{"a", "b"}, r.Tenants())
+}
+
+func TestTenantGuard(t *testing.T) {
+	r := newTenantRouter(t, TenantConfig{})
+	engine, err := r.EngineFor("a")
+	require.NoError(t, err)
+	require.NoError(t, engine.Context(WithTenant(ctx, "a")).AutoMigrate(&rwRecord{}))
+
+	var records []rwRecord
+	err = engine.Context(ctx).Find(&records).Error
+	require.True(t, errors.Is(err, ErrTenantRequired))
+	err = engine.Context(WithTenant(ctx, "b")).Create(&rwRecord{ID: 1}).Error
+	require.True(t, errors.Is(err, ErrTenantMismatch))
+	err = engine.Context(ctx).Exec("DELETE FROM rw_record").Error
+	require.True(t, errors.Is(err, ErrTenantRequired))
+
+	require.NoError(t, engine.Context(WithTenant(ctx, "a")).Find(&records).Error)
+}
+
+func TestTenantEviction(t *testing.T) {
+	r := newTenantRouter(t, TenantConfig{MaxEngines: 2, CloseGrace: 20 * time.Millisecond})
+
+	a, err := r.EngineFor("a")
+	require.NoError(t, err)
+	_, err = r.EngineFor("b")
+	require.NoError(t, err)
+	_, err = r.EngineFor("a")
+	require.NoError(t, err)
+	_, err = r.EngineFor("c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "a"}, r.Tenants())
+	require.Equal(t, HealthUp, a.Health(ctx).Status)
+
+	// 再次使用时重新创建
+	b, err := r.EngineFor("b")
+	require.NoError(t, err)
+	require.Equal(t, HealthUp, b.Health(ctx).Status)
+	require.Equal(t, []string{"b", "c"}, r.Tenants())
+	// 淘汰的实例在CloseGrace后关闭，已取得的实例在此期间仍可使用
+	require.Equal(t, HealthUp, a.Health(ctx).Status)
+	require.Eventually(t, func() bool { return a.Health(ctx).Status == HealthDown }, time.Second, 5*time.Millisecond)
+
+	// 空闲超时
+	r.conf.IdleTimeout = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	_, err = r.EngineFor("b")
+	require.NoError(t, err)
+	r.evictIdle()
+	require.Equal(t, []string{"b"}, r.Tenants())
+
+	// 关闭时等待关闭的实例也被关闭
+	r.conf.CloseGrace = time.Hour
+	b, err = r.EngineFor("b")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	r.evictIdle()
+	require.Empty(t, r.Tenants())
+	require.NoError(t, r.Close())
+	require.Equal(t, HealthDown, b.Health(ctx).Status)
+	_, err = r.EngineFor("b")
+	require.True(t, errors.Is(err, ErrTenantRouterClosed))
+}
+
+func TestTenantConfig(t *testing.T) {
+	_, err := NewTenantRouter(&TenantConfig{Mode: "table"})
+	require.Error(t, err)
+	_, err = NewTenantRouter(&TenantConfig{Pattern: "tenant"})
+	require.Error(t, err)
+	// schema模式只支持postgres
+	_, err = NewTenantRouter(&TenantConfig{Mode: TenantModeSchema, Template: Config{Driver: "mysql"}})
+	require.Error(t, err)
+	_, err = NewTenantRouter(&TenantConfig{Template: Config{Driver: "mysql", Replicas: []Replica{{DSN: "r1"}}}})
+	require.Error(t, err)
+
+	r, err := NewTenantRouter(&TenantConfig{
+		Template: Config{Driver: "mysql", Database: "app", Replicas: []Replica{{Server: "r1"}, {Server: "r2", Database: "x"}}},
+		Pattern:  "tenant_%s",
+	})
+	require.NoError(t, err)
+	conf := r.tenantConfig("a")
+	require.Equal(t, "tenant_a", conf.Database)
+	require.Equal(t, []Replica{{Server: "r1", Database: "tenant_a"}, {Server: "r2", Database: "tenant_a"}}, conf.Replicas)
+	require.Equal(t, "app", r.conf.Template.Database)
+	require.Equal(t, "x", r.conf.Template.Replicas[1].Database)
+
+	r, err = NewTenantRouter(&TenantConfig{
+		Mode:     TenantModeSchema,
+		Template: Config{Driver: "postgres", Database: "app", Params: map[string]string{"application_name": "x"}, Replicas: []Replica{{Server: "r1"}}},
+		Pattern:  "tenant_%s",
+	})
+	require.NoError(t, err)
+	conf = r.tenantConfig("a")
+	require.Equal(t, "app", conf.Database)
+	require.Equal(t, map[string]string{"application_name": "x", "search_path": "tenant_a"}, conf.Params)
+	require.Len(t, r.conf.Template.Params, 1)
+	dsn, err := BuildDSN(conf)
+	require.NoError(t, err)
+	require.Contains(t, dsn, "search_path=tenant_a")
+	// 从库复制主库的配置，同样设置search_path
+	require.Equal(t, "tenant_a", conf.Replicas[0].config(conf).Params["search_path"])
+}
+
+// tenantNamedRecord 指定了表名，表名前缀对其不生效
+type tenantNamedRecord struct {
+	ID   int
+	Name string
+}
+
+func (tenantNamedRecord) TableName() string { return "tenant_named" }
+
+func TestTenantTableName(t *testing.T) {
+	r := newTenantRouter(t, TenantConfig{})
+	ctxA, ctxB := WithTenant(ctx, "a"), WithTenant(ctx, "b")
+	for _, c := range []context.Context{ctxA, ctxB} {
+		db, err := r.DB(c)
+		require.NoError(t, err)
+		require.NoError(t, db.AutoMigrate(&tenantNamedRecord{}))
+	}
+
+	dbA, err := r.DB(ctxA)
+	require.NoError(t, err)
+	require.NoError(t, dbA.Create(&tenantNamedRecord{ID: 1, Name: "a"}).Error)
+
+	dbB, err := r.DB(ctxB)
+	require.NoError(t, err)
+	var records []tenantNamedRecord
+	require.NoError(t, dbB.Find(&records).Error)
+	require.Empty(t, records)
+}
+
+func TestTenantConcurrent(t *testing.T) {
+	r := newTenantRouter(t, TenantConfig{})
+
+	// 同一租户只创建一个实例
+	var wg sync.WaitGroup
+	engines := make([]*Engine, 15)
+	errs := make([]error, len(engines))
+	for i := range engines {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			engines[i], errs[i] = r.EngineFor([]string{"a", "b", "c"}[i%3])
+		}(i)
+	}
+	wg.Wait()
+	for i := range engines {
+		require.NoError(t, errs[i])
+		require.Same(t, engines[i%3], engines[i])
+	}
+	require.Len(t, r.Tenants(), 3)
+
+	// 创建失败时不缓存
+	r.conf.Pattern = filepath.Join(t.TempDir(), "missing", "tenant_%s.db")
+	_, err := r.EngineFor("d")
+	require.Error(t, err)
+	require.NotContains(t, r.Tenants(), "d")
+}
@@ -0,0 +1,102 @@
+package gorm
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+/* 按OpenTelemetry数据库语义约定记录span */
+
+// dbSystems 是驱动对应的db.system
+var dbSystems = map[string]attribute.KeyValue{
+	"mysql":      semconv.DBSystemMySQL,
+	"postgres":   semconv.DBSystemPostgreSQL,
+	"clickhouse": semconv.DBSystemClickhouse,
+	"sqlite":     semconv.DBSystemSqlite,
+}
+
+// sqlOperations 是回调对应的SQL操作，row及raw从SQL中获取
+var sqlOperations = map[string]string{
+	OpCreate: "INSERT",
+	OpQuery:  "SELECT",
+	OpUpdate: "UPDATE",
+	OpDelete: "DELETE",
+}
+
+// connAttributes 返回连接相关的span属性
+func connAttributes(conf *Config) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 4)
+	if system, ok := dbSystems[conf.Driver]; ok {
+		attrs = append(attrs, system)
+	} else if conf.Driver != "" {
+		attrs = append(attrs, semconv.DBSystemKey.String(conf.Driver))
+	}
+	if conf.Database != "" {
+		attrs = append(attrs, semconv.DBNameKey.String(conf.Database))
+	}
+	if conf.Driver != "sqlite" && conf.Server != "" {
+		attrs = append(attrs, semconv.ServerAddressKey.String(conf.Server))
+		if conf.Port > 0 {
+			attrs = append(attrs, semconv.ServerPortKey.Int(conf.Port))
+		}
+	}
+
+	return attrs
+}
+
+// spanParent 返回span的父上下文：优先使用 Engine.Context 设置的上下文，
+// 其次是带有span的 WithContext 上下文，都没有时不记录span
+func spanParent(db *gorm.DB) context.Context {
+	if parentCtx, ok := db.Get(parentSpanGormCtxKey); ok {
+		if ctx, ok := parentCtx.(context.Context); ok {
+			return ctx
+		}
+	}
+	if ctx := db.Statement.Context; ctx != nil && trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	return nil
+}
+
+// operation 返回SQL的操作，如 SELECT、INSERT
+func operation(db *gorm.DB, op string) string {
+	if name, ok := sqlOperations[op]; ok {
+		return name
+	}
+
+	sql := strings.TrimSpace(db.Statement.SQL.String())
+	if i := strings.IndexAny(sql, " \t\n("); i > 0 {
+		sql = sql[:i]
+	}
+	if sql == "" {
+		return strings.ToUpper(op)
+	}
+
+	return strings.ToUpper(sql)
+}
+
+// spanName 按语义约定返回 "操作 表名"，没有表名时为操作
+func spanName(db *gorm.DB, op string) string {
+	name := operation(db, op)
+	if table := db.Statement.Table; table != "" {
+		name += " " + table
+	}
+
+	return name
+}
+
+// statement 返回记录在span中的SQL，TraceRedactVars 为true时不带参数值
+func (c *callbacks) statement(db *gorm.DB) string {
+	sql := db.Statement.SQL.String()
+	if c.conf.TraceRedactVars || len(db.Statement.Vars) == 0 {
+		return sql
+	}
+
+	return db.Dialector.Explain(sql, db.Statement.Vars...)
+}
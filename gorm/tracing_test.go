@@ -0,0 +1,164 @@
+package gorm
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// memSpan 是保存在内存中的span
+type memSpan struct {
+	trace.Span
+	sc     trace.SpanContext
+	name   string
+	kind   trace.SpanKind
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	errs   []error
+	ended  bool
+}
+
+func (s *memSpan) IsRecording() bool              { return true }
+func (s *memSpan) SpanContext() trace.SpanContext { return s.sc }
+func (s *memSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+func (s *memSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+func (s *memSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *memSpan) End(...trace.SpanEndOption)                    { s.ended = true }
+
+// memTracerProvider 记录所有创建的span
+type memTracerProvider struct {
+	noop.TracerProvider
+	mu    sync.Mutex
+	spans []*memSpan
+}
+
+func (p *memTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &memTracer{p: p}
+}
+
+func (p *memTracerProvider) ended() []*memSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	spans := make([]*memSpan, 0, len(p.spans))
+	for _, span := range p.spans {
+		if span.ended {
+			spans = append(spans, span)
+		}
+	}
+
+	return spans
+}
+
+type memTracer struct {
+	noop.Tracer
+	p *memTracerProvider
+}
+
+func (t *memTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	span := &memSpan{
+		Span:  trace.SpanFromContext(context.Background()),
+		sc:    trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled}),
+		name:  name,
+		kind:  cfg.SpanKind(),
+		attrs: make(map[attribute.Key]attribute.Value),
+	}
+	span.SetAttributes(cfg.Attributes()...)
+
+	t.p.mu.Lock()
+	t.p.spans = append(t.p.spans, span)
+	t.p.mu.Unlock()
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func useMemTracer(t *testing.T) *memTracerProvider {
+	t.Helper()
+
+	provider := &memTracerProvider{}
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	return provider
+}
+
+func TestTracingSpans(t *testing.T) {
+	provider := useMemTracer(t)
+	db := newTestEngine(t, sqliteConfig(t, "trace.db"), &rwRecord{})
+	require.Empty(t, provider.ended(), "no span without context")
+
+	require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 1, Name: "secret"}).Error)
+	require.Error(t, db.Context(ctx).Table("missing").Find(&[]rwRecord{}).Error)
+	require.NoError(t, db.Context(ctx).Exec("UPDATE rw_record SET name = ? WHERE id = ?", "x", 1).Error)
+
+	spans := provider.ended()
+	require.Len(t, spans, 3)
+
+	insert := spans[0]
+	require.Equal(t, "INSERT rw_record", insert.name)
+	require.Equal(t, trace.SpanKindClient, insert.kind)
+	require.Equal(t, "sqlite", insert.attrs["db.system"].AsString())
+	require.Equal(t, db.conf.Database, insert.attrs["db.name"].AsString())
+	require.Equal(t, "INSERT", insert.attrs["db.operation"].AsString())
+	require.Equal(t, "rw_record", insert.attrs["db.sql.table"].AsString())
+	require.Contains(t, insert.attrs["db.statement"].AsString(), `"secret"`)
+	require.Equal(t, int64(1), insert.attrs["db.rows_affected"].AsInt64())
+	require.Equal(t, codes.Unset, insert.status)
+	for key := range insert.attrs {
+		require.NotContains(t, string(key), "μ")
+	}
+
+	failed := spans[1]
+	require.Equal(t, "SELECT missing", failed.name)
+	require.Equal(t, codes.Error, failed.status)
+	require.Len(t, failed.errs, 1)
+
+	raw := spans[2]
+	require.Equal(t, "UPDATE", raw.name)
+	require.Equal(t, "UPDATE", raw.attrs["db.operation"].AsString())
+}
+
+func TestTracingRedactAndContext(t *testing.T) {
+	provider := useMemTracer(t)
+	conf := sqliteConfig(t, "trace.db")
+	conf.TraceRedactVars = true
+	db := newTestEngine(t, conf, &rwRecord{})
+
+	// WithContext带有span时同样记录
+	parentCtx, parent := otel.Tracer("test").Start(ctx, "parent")
+	parent.End()
+	var rec rwRecord
+	require.ErrorIs(t, db.GetDB().WithContext(parentCtx).Where("name = ?", "secret").First(&rec).Error, ErrRecordNotFound)
+
+	spans := provider.ended()
+	require.Len(t, spans, 2)
+	spans = spans[1:]
+	require.Equal(t, "SELECT rw_record", spans[0].name)
+	require.NotContains(t, spans[0].attrs["db.statement"].AsString(), "secret")
+	require.Contains(t, spans[0].attrs["db.statement"].AsString(), "?")
+	// 记录未找到不算错误
+	require.Equal(t, codes.Unset, spans[0].status)
+}
+
+func TestConnAttributes(t *testing.T) {
+	attrs := connAttributes(&Config{Driver: "postgres", Server: "pg.local", Port: 5432, Database: "db"})
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.name", "db"),
+		attribute.String("server.address", "pg.local"),
+		attribute.Int("server.port", 5432),
+	}, attrs)
+}
@@ -0,0 +1,118 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* 事务，事务保存在上下文中，嵌套调用时使用savepoint */
+
+var defaultTxBackoff = 50 * time.Millisecond
+
+// txCtxKey 按DB实例区分上下文中的事务
+type txCtxKey struct {
+	engine *Engine
+}
+
+// txOptions 是事务的选项
+type txOptions struct {
+	sqlOpts   sql.TxOptions
+	retries   int
+	backoff   time.Duration
+	retryable func(error) bool
+}
+
+// TxOption 是 Tx 的选项
+type TxOption func(*txOptions)
+
+// WithIsolation 设置事务的隔离级别
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) {
+		o.sqlOpts.Isolation = level
+	}
+}
+
+// WithReadOnly 开启只读事务
+func WithReadOnly() TxOption {
+	return func(o *txOptions) {
+		o.sqlOpts.ReadOnly = true
+	}
+}
+
+// WithTxRetry 事务因死锁、序列化失败等错误失败时最多重试retries次，
+// 重试间隔从backoff开始每次翻倍，backoff为0时为50ms
+func WithTxRetry(retries int, backoff time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.retries = retries
+		if backoff > 0 {
+			o.backoff = backoff
+		}
+	}
+}
+
+// WithRetryIf 自定义可重试的错误，默认为死锁及序列化失败
+func WithRetryIf(retryable func(error) bool) TxOption {
+	return func(o *txOptions) {
+		o.retryable = retryable
+	}
+}
+
+// Tx 在事务中执行fn，fn返回错误或panic时回滚，否则提交。事务保存在传给fn的上下文中，
+// 通过 Context(ctx) 获取的DB会在该事务中执行；嵌套调用 Tx 时加入外层事务并使用savepoint，
+// 内层返回错误只回滚到savepoint，此时隔离级别及重试选项不生效
+func (db *Engine) Tx(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	if tx := db.txFromContext(ctx); tx != nil {
+		return tx.WithContext(ctx).Transaction(func(sub *gorm.DB) error {
+			return fn(db.withTx(ctx, sub))
+		})
+	}
+
+	o := txOptions{backoff: defaultTxBackoff, retryable: isRetryableTxError}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	backoff := o.backoff
+	for attempt := 0; ; attempt++ {
+		err := db.Context(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(db.withTx(ctx, tx))
+		}, &o.sqlOpts)
+		if err == nil || attempt >= o.retries || !o.retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (db *Engine) withTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txCtxKey{engine: db}, tx)
+}
+
+// txFromContext 返回上下文中本实例的事务
+func (db *Engine) txFromContext(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return nil
+	}
+	tx, _ := ctx.Value(txCtxKey{engine: db}).(*gorm.DB)
+
+	return tx
+}
+
+// InTx 判断上下文中是否有本实例的事务
+func (db *Engine) InTx(ctx context.Context) bool {
+	return db.txFromContext(ctx) != nil
+}
+
+// isRetryableTxError 判断是否为死锁、序列化失败或锁等待超时等可重试的错误
+func isRetryableTxError(err error) bool {
+	return IsDeadlock(err) || IsSerializationFailure(err) || isLockTimeout(err)
+}
@@ -0,0 +1,129 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	require "github.com/stretchr/testify/require"
+)
+
+func newTxEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	return newTestEngine(t, sqliteConfig(t, "tx.db"), &rwRecord{})
+}
+
+func countRecords(t *testing.T, db *Engine) int64 {
+	t.Helper()
+
+	var count int64
+	require.NoError(t, db.Context(ctx).Model(&rwRecord{}).Count(&count).Error)
+
+	return count
+}
+
+func TestTxCommitAndRollback(t *testing.T) {
+	db := newTxEngine(t)
+
+	require.NoError(t, db.Tx(ctx, func(ctx context.Context) error {
+		require.True(t, db.InTx(ctx))
+		return db.Context(ctx).Create(&rwRecord{ID: 1, Name: "a"}).Error
+	}))
+	require.Equal(t, int64(1), countRecords(t, db))
+
+	errAbort := errors.New("abort")
+	err := db.Tx(ctx, func(ctx context.Context) error {
+		require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 2, Name: "b"}).Error)
+		// 事务中可以读到未提交的数据
+		var rec rwRecord
+		require.NoError(t, db.Context(ctx).First(&rec, 2).Error)
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+	require.Equal(t, int64(1), countRecords(t, db))
+	require.False(t, db.InTx(ctx))
+}
+
+func TestTxNestedSavepoint(t *testing.T) {
+	db := newTxEngine(t)
+
+	require.NoError(t, db.Tx(ctx, func(ctx context.Context) error {
+		require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 1, Name: "outer"}).Error)
+
+		// 内层失败只回滚到savepoint
+		err := db.Tx(ctx, func(ctx context.Context) error {
+			require.NoError(t, db.Context(ctx).Create(&rwRecord{ID: 2, Name: "inner"}).Error)
+			return errors.New("inner failed")
+		})
+		require.Error(t, err)
+
+		return db.Tx(ctx, func(ctx context.Context) error {
+			return db.Context(ctx).Create(&rwRecord{ID: 3, Name: "inner ok"}).Error
+		})
+	}))
+
+	var names []string
+	require.NoError(t, db.Context(ctx).Model(&rwRecord{}).Order("id").Pluck("name", &names).Error)
+	require.Equal(t, []string{"outer", "inner ok"}, names)
+}
+
+func TestTxPerEngine(t *testing.T) {
+	db := newTxEngine(t)
+	other := newTxEngine(t)
+
+	require.NoError(t, db.Tx(ctx, func(ctx context.Context) error {
+		require.True(t, db.InTx(ctx))
+		require.False(t, other.InTx(ctx))
+		return nil
+	}))
+}
+
+func TestTxRetry(t *testing.T) {
+	db := newTxEngine(t)
+
+	attempts := 0
+	start := time.Now()
+	err := db.Tx(ctx, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+		}
+		return db.Context(ctx).Create(&rwRecord{ID: attempts, Name: "retry"}).Error
+	}, WithTxRetry(3, 5*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// 不可重试的错误
+	attempts = 0
+	err = db.Tx(ctx, func(context.Context) error {
+		attempts++
+		return errors.New("syntax error")
+	}, WithTxRetry(3, time.Millisecond))
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+
+	// 自定义可重试的错误
+	attempts = 0
+	errBusy := errors.New("busy")
+	err = db.Tx(ctx, func(context.Context) error {
+		attempts++
+		return errBusy
+	}, WithTxRetry(2, time.Millisecond), WithRetryIf(func(err error) bool { return errors.Is(err, errBusy) }))
+	require.ErrorIs(t, err, errBusy)
+	require.Equal(t, 3, attempts)
+}
+
+func TestTxOptions(t *testing.T) {
+	var o txOptions
+	for _, opt := range []TxOption{WithIsolation(sql.LevelSerializable), WithReadOnly(), WithTxRetry(2, 0)} {
+		opt(&o)
+	}
+	require.Equal(t, sql.LevelSerializable, o.sqlOpts.Isolation)
+	require.True(t, o.sqlOpts.ReadOnly)
+	require.Equal(t, 2, o.retries)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/bwmarrin/snowflake"
 	"github.com/gofrs/uuid/v5"
@@ -30,6 +31,19 @@ func New() *UnionUUID {
 	}
 }
 
+// NewWithNode 使用指定节点ID的雪花算法，多实例部署时每个实例的节点ID需不同，范围为0-1023
+func NewWithNode(node int64) (*UnionUUID, error) {
+	snowNode, err := snowflake.NewNode(node)
+	if err != nil {
+		return nil, err
+	}
+	return &UnionUUID{
+		alphabet:  "",
+		minLength: 16,
+		snowNode:  snowNode,
+	}, nil
+}
+
 func NewWithAlphabet(alphabet string) *UnionUUID {
 	node, _ := snowflake.NewNode(1)
 	return &UnionUUID{
@@ -123,6 +137,21 @@ func (s *UnionUUID) GenShort24With() string {
 	return fmt.Sprintf("%024s", u)
 }
 
+// GenSnowflake 产生一个64位的雪花算法ID，高位为毫秒时间戳，可按时间排序
+func (s *UnionUUID) GenSnowflake() int64 {
+	return s.snowNode.Generate().Int64()
+}
+
+// SnowflakeTime 返回雪花算法ID中的时间
+func SnowflakeTime(id int64) time.Time {
+	return time.UnixMilli(snowflake.ParseInt64(id).Time())
+}
+
+// SnowflakeNode 返回雪花算法ID中的节点ID
+func SnowflakeNode(id int64) int64 {
+	return snowflake.ParseInt64(id).Node()
+}
+
 func (s *UnionUUID) GenSnowflake16() (string, error) {
 	var nodeIDMask int64 = 1023 << 12 // mask to get Node ID
 	var sequenceIDMask int64 = 4095   // mask to get sequence ID
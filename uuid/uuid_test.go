@@ -169,3 +169,31 @@ func TestShortSnowflake(t *testing.T) {
 	elapsed := time.Since(start)
 	fmt.Printf("该函数执行完成耗时: %s\n", elapsed)
 }
+
+func TestGenSnowflake(t *testing.T) {
+	uid, err := NewWithNode(7)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	start := time.Now().Truncate(time.Millisecond)
+	last := int64(0)
+	for index := 0; index < 10000; index++ {
+		id := uid.GenSnowflake()
+		if id <= last {
+			t.Fatalf("id not increasing: %d <= %d", id, last)
+		}
+		last = id
+	}
+
+	if node := SnowflakeNode(last); node != 7 {
+		t.Errorf("node: %d", node)
+	}
+	if ts := SnowflakeTime(last); ts.Before(start) || ts.After(time.Now()) {
+		t.Errorf("time: %s", ts)
+	}
+
+	if _, err := NewWithNode(1024); err == nil {
+		t.Error("node out of range")
+	}
+}
@@ -0,0 +1,410 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/* 审计日志：每一行都包含上一行的HMAC，形成hash链，不持有密钥时任何修改、删除或截断都可以被校验出来 */
+
+var (
+	// ErrAuditNotInit 是审计日志未初始化时返回的错误
+	ErrAuditNotInit = errors.New("zlog: audit logger is not initialized")
+	// ErrAuditKeyRequired 是没有配置审计日志的HMAC密钥
+	ErrAuditKeyRequired = errors.New("zlog: audit key is required")
+)
+
+// AuditRecord 是一条审计日志，谁(Actor)在什么时间对什么对象(Subject)做了什么(Action)
+type AuditRecord struct {
+	Seq      uint64          `json:"seq"`
+	Time     string          `json:"time"`
+	Actor    string          `json:"actor,omitempty"`
+	Action   string          `json:"action"`
+	Subject  string          `json:"subject"`
+	TraceID  string          `json:"trace_id,omitempty"`
+	Details  json.RawMessage `json:"details,omitempty"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash,omitempty"`
+}
+
+// computeHash 计算不含Hash字段的记录的HMAC-SHA256，记录中包含PrevHash，因此形成hash链
+func (r AuditRecord) computeHash(key []byte) (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	return auditMAC(key, b), nil
+}
+
+func auditMAC(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data) //nolint:errcheck,gosec
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auditHead 记录最后一条审计日志的序号及hash，用于校验文件末尾是否被截断，MAC防止head被改写
+type auditHead struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac"`
+}
+
+func (h auditHead) computeMAC(key []byte) string {
+	return auditMAC(key, []byte(fmt.Sprintf("%d:%s", h.Seq, h.Hash)))
+}
+
+func auditHeadPath(path string) string {
+	return path + ".head"
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor 将操作人存入上下文，Audit时会记录到actor字段
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+func auditActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(auditActorKey{}).(string)
+
+	return actor
+}
+
+// Auditor 是写入独立文件的审计日志对象，并发安全
+type Auditor struct {
+	mu       sync.Mutex
+	path     string
+	key      []byte
+	file     *os.File
+	seq      uint64
+	lastHash string
+	// broken 不为空时文件中可能残留了不完整的记录，拒绝继续写入
+	broken error
+}
+
+// NewAuditor 打开审计日志文件，key是hash链的HMAC密钥。文件已存在时先完整校验，
+// 校验通过后从最后一条记录继续hash链，文件被修改或截断时返回 *AuditVerifyError
+func NewAuditor(path string, key []byte) (*Auditor, error) {
+	if len(key) == 0 {
+		return nil, ErrAuditKeyRequired
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := verifyAuditChain(file, key)
+	if err == nil {
+		err = chain.checkHead(path, key)
+		switch {
+		case err == nil && chain.count == 0:
+			// 新文件先写入seq为0的head，第一条记录写入后、更新head前退出时也能修复
+			err = writeAuditHead(path, key, chain.last)
+		case err != nil && chain.headLagging(path, key):
+			// 写入记录后、更新head前退出时head落后一条，最后一条记录的HMAC有效，修复head即可
+			err = writeAuditHead(path, key, chain.last)
+		}
+	}
+	if err != nil {
+		file.Close() //nolint:errcheck,gosec
+		return nil, fmt.Errorf("zlog: open audit file %s: %w", path, err)
+	}
+
+	return &Auditor{
+		path:     path,
+		key:      append([]byte(nil), key...),
+		file:     file,
+		seq:      chain.last.Seq,
+		lastHash: chain.last.Hash,
+	}, nil
+}
+
+// Audit 写入一条审计日志，操作人从上下文中获取，见 WithAuditActor
+func (a *Auditor) Audit(ctx context.Context, action, subject string, details Fields) error {
+	record := AuditRecord{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Actor:   auditActorFromContext(ctx),
+		Action:  action,
+		Subject: subject,
+		TraceID: traceIDFromContext(ctx),
+	}
+	if len(details) > 0 {
+		b, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		record.Details = b
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return os.ErrClosed
+	}
+	if a.broken != nil {
+		return a.broken
+	}
+
+	record.Seq = a.seq + 1
+	record.PrevHash = a.lastHash
+	hash, err := record.computeHash(a.key)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := a.appendLine(append(line, '\n')); err != nil {
+		return err
+	}
+
+	a.seq = record.Seq
+	a.lastHash = record.Hash
+
+	return writeAuditHead(a.path, a.key, record)
+}
+
+// appendLine 写入一行并同步到磁盘，失败时截断到写入前的大小，避免残留的半行记录破坏hash链；
+// 截断也失败时不再写入，需人工检查文件
+func (a *Auditor) appendLine(line []byte) error {
+	info, err := a.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = a.file.Write(line)
+	if err == nil {
+		err = a.file.Sync()
+	}
+	if err == nil {
+		return nil
+	}
+	if terr := a.file.Truncate(info.Size()); terr != nil {
+		a.broken = fmt.Errorf("zlog: audit file %s may hold a partial record: %w", a.path, errors.Join(err, terr))
+	}
+
+	return err
+}
+
+// Close 关闭审计日志文件
+func (a *Auditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+
+	return err
+}
+
+// writeAuditHead 将last记录为最后一条记录，先写临时文件再重命名，保证head文件完整
+func writeAuditHead(path string, key []byte, last AuditRecord) error {
+	head := auditHead{Seq: last.Seq, Hash: last.Hash}
+	head.MAC = head.computeMAC(key)
+	b, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	tmp := auditHeadPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, auditHeadPath(path))
+}
+
+// AuditVerifyError 是审计日志校验失败的错误，Line为出错的行号（从1开始）
+type AuditVerifyError struct {
+	Line   int
+	Reason string
+}
+
+func (e *AuditVerifyError) Error() string {
+	return fmt.Sprintf("zlog: audit file verify failed at line %d: %s", e.Line, e.Reason)
+}
+
+// VerifyAudit 使用key校验审计日志文件的hash链，返回校验通过的记录条数。
+// 可检测出记录被修改、删除、插入，以及文件开头或末尾被截断（末尾依赖Auditor维护的 .head 文件）
+func VerifyAudit(path string, key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrAuditKeyRequired
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	chain, err := verifyAuditChain(file, key)
+	if err != nil {
+		return chain.count, err
+	}
+
+	return chain.count, chain.checkHead(path, key)
+}
+
+// auditChain 是校验通过的hash链
+type auditChain struct {
+	count int
+	lines int
+	// last 为最后一条记录，prev 为倒数第二条
+	last, prev AuditRecord
+}
+
+// verifyAuditChain 逐行校验hash链
+func verifyAuditChain(r io.Reader, key []byte) (auditChain, error) {
+	var chain auditChain
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		chain.lines++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return chain, &AuditVerifyError{Line: chain.lines, Reason: "malformed record: " + err.Error()}
+		}
+		if record.Seq != chain.last.Seq+1 {
+			return chain, &AuditVerifyError{Line: chain.lines, Reason: fmt.Sprintf("expected seq %d, got %d", chain.last.Seq+1, record.Seq)}
+		}
+		if record.PrevHash != chain.last.Hash {
+			return chain, &AuditVerifyError{Line: chain.lines, Reason: "prev_hash does not match previous record"}
+		}
+		hash, err := record.computeHash(key)
+		if err != nil {
+			return chain, &AuditVerifyError{Line: chain.lines, Reason: err.Error()}
+		}
+		if !hmac.Equal([]byte(hash), []byte(record.Hash)) {
+			return chain, &AuditVerifyError{Line: chain.lines, Reason: "record hash mismatch, record was modified"}
+		}
+
+		chain.prev, chain.last = chain.last, record
+		chain.count++
+	}
+
+	return chain, scanner.Err()
+}
+
+// readAuditHead 读取并校验head文件，文件不存在时返回nil
+func readAuditHead(path string, key []byte) (*auditHead, error) {
+	b, err := os.ReadFile(auditHeadPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var head auditHead
+	if err := json.Unmarshal(b, &head); err != nil {
+		return nil, fmt.Errorf("malformed head file: %w", err)
+	}
+	if !hmac.Equal([]byte(head.MAC), []byte(head.computeMAC(key))) {
+		return nil, errors.New("head file mac mismatch, head was modified")
+	}
+
+	return &head, nil
+}
+
+// checkHead 校验head文件是否指向最后一条记录
+func (c auditChain) checkHead(path string, key []byte) error {
+	head, err := readAuditHead(path, key)
+	if err != nil {
+		return &AuditVerifyError{Line: c.lines, Reason: err.Error()}
+	}
+	if head == nil {
+		if c.count == 0 {
+			return nil
+		}
+		return &AuditVerifyError{Line: c.lines, Reason: "head file unavailable"}
+	}
+	if head.Seq != c.last.Seq || head.Hash != c.last.Hash {
+		return &AuditVerifyError{
+			Line:   c.lines,
+			Reason: fmt.Sprintf("file truncated, head is seq %d but last record is seq %d", head.Seq, c.last.Seq),
+		}
+	}
+
+	return nil
+}
+
+// headLagging 判断MAC有效的head是否正好指向倒数第二条记录，head不存在时不能判断文件是否被截断
+func (c auditChain) headLagging(path string, key []byte) bool {
+	if c.count == 0 {
+		return false
+	}
+	head, err := readAuditHead(path, key)
+	if err != nil || head == nil {
+		return false
+	}
+
+	return head.Seq == c.prev.Seq && head.Hash == c.prev.Hash
+}
+
+var (
+	mAuditMu sync.RWMutex
+	mAudit   *Auditor
+)
+
+// InitAudit 初始化全局的审计日志，配置了 auditPath 时 InitLogger 会自动调用
+func InitAudit(path string, key []byte) error {
+	auditor, err := NewAuditor(path, key)
+	if err != nil {
+		return err
+	}
+
+	mAuditMu.Lock()
+	prev := mAudit
+	mAudit = auditor
+	mAuditMu.Unlock()
+
+	if prev != nil {
+		prev.Close() //nolint:errcheck,gosec
+	}
+
+	return nil
+}
+
+// Audit 写入一条全局审计日志
+func Audit(ctx context.Context, action, subject string, details Fields) error {
+	mAuditMu.RLock()
+	auditor := mAudit
+	mAuditMu.RUnlock()
+
+	if auditor == nil {
+		return ErrAuditNotInit
+	}
+
+	return auditor.Audit(ctx, action, subject, details)
+}
@@ -0,0 +1,262 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+var testAuditKey = []byte("audit-test-key")
+
+func writeAuditFile(t *testing.T, n int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+	auditor, err := NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+
+	actorCtx := WithAuditActor(context.Background(), "admin")
+	for i := 0; i < n; i++ {
+		require.NoError(t, auditor.Audit(actorCtx, "user.update", "user:1", Fields{"index": i, "field": "email"}))
+	}
+	require.NoError(t, auditor.Close())
+
+	return path
+}
+
+func readAuditLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	return bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+}
+
+func writeAuditLines(t *testing.T, path string, lines [][]byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o600))
+}
+
+func requireVerifyError(t *testing.T, path string, line int, reason string) {
+	t.Helper()
+	requireVerifyErrorKey(t, path, testAuditKey, line, reason)
+}
+
+func requireVerifyErrorKey(t *testing.T, path string, key []byte, line int, reason string) {
+	t.Helper()
+
+	_, err := VerifyAudit(path, key)
+	var verifyErr *AuditVerifyError
+	require.True(t, errors.As(err, &verifyErr), "unexpected error %v", err)
+	require.Equal(t, line, verifyErr.Line)
+	require.Contains(t, verifyErr.Reason, reason)
+}
+
+func TestAuditVerify(t *testing.T) {
+	path := writeAuditFile(t, 3)
+
+	count, err := VerifyAudit(path, testAuditKey)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	lines := readAuditLines(t, path)
+	require.Contains(t, string(lines[0]), `"actor":"admin"`)
+	require.Contains(t, string(lines[0]), `"prev_hash":""`)
+
+	// 重新打开后继续hash链
+	auditor, err := NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+	require.NoError(t, auditor.Audit(context.Background(), "user.delete", "user:1", nil))
+	require.NoError(t, auditor.Close())
+	require.Error(t, auditor.Audit(context.Background(), "user.delete", "user:2", nil))
+
+	count, err = VerifyAudit(path, testAuditKey)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
+
+func TestAuditVerifyModified(t *testing.T) {
+	path := writeAuditFile(t, 3)
+	lines := readAuditLines(t, path)
+	lines[1] = []byte(strings.Replace(string(lines[1]), `"email"`, `"phone"`, 1))
+	writeAuditLines(t, path, lines)
+
+	requireVerifyError(t, path, 2, "modified")
+}
+
+func TestAuditVerifyDeleted(t *testing.T) {
+	path := writeAuditFile(t, 3)
+	lines := readAuditLines(t, path)
+	writeAuditLines(t, path, [][]byte{lines[0], lines[2]})
+
+	requireVerifyError(t, path, 2, "expected seq 2")
+}
+
+func TestAuditVerifyTruncated(t *testing.T) {
+	// 末尾被截断
+	path := writeAuditFile(t, 3)
+	lines := readAuditLines(t, path)
+	writeAuditLines(t, path, lines[:2])
+	requireVerifyError(t, path, 2, "truncated")
+
+	// 开头被截断
+	path = writeAuditFile(t, 3)
+	lines = readAuditLines(t, path)
+	writeAuditLines(t, path, lines[1:])
+	requireVerifyError(t, path, 1, "expected seq 1")
+
+	// 最后一行只写了一半
+	path = writeAuditFile(t, 3)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content[:len(content)-10], 0o600))
+	requireVerifyError(t, path, 3, "malformed")
+
+	// 文件被清空
+	path = writeAuditFile(t, 1)
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	requireVerifyError(t, path, 0, "truncated")
+}
+
+func TestGlobalAudit(t *testing.T) {
+	mAuditMu.Lock()
+	prev := mAudit
+	mAudit = nil
+	mAuditMu.Unlock()
+	defer func() {
+		mAuditMu.Lock()
+		mAudit = prev
+		mAuditMu.Unlock()
+	}()
+
+	require.ErrorIs(t, Audit(context.Background(), "login", "user:1", nil), ErrAuditNotInit)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, InitAudit(path, testAuditKey))
+	defer mAudit.Close() //nolint:errcheck
+
+	require.NoError(t, Audit(ctx, "login", "user:1", Fields{"ip": "127.0.0.1"}))
+	count, err := VerifyAudit(path, testAuditKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestAuditReopenTampered(t *testing.T) {
+	// 末尾被截断后不能继续写入，否则head会被改写，截断无法再被发现
+	path := writeAuditFile(t, 3)
+	lines := readAuditLines(t, path)
+	writeAuditLines(t, path, lines[:2])
+
+	_, err := NewAuditor(path, testAuditKey)
+	var verifyErr *AuditVerifyError
+	require.True(t, errors.As(err, &verifyErr), "unexpected error %v", err)
+	require.Contains(t, verifyErr.Reason, "truncated")
+	requireVerifyError(t, path, 2, "truncated")
+
+	// 记录被修改
+	path = writeAuditFile(t, 2)
+	lines = readAuditLines(t, path)
+	lines[1] = []byte(strings.Replace(string(lines[1]), `"email"`, `"phone"`, 1))
+	writeAuditLines(t, path, lines)
+	_, err = NewAuditor(path, testAuditKey)
+	require.True(t, errors.As(err, &verifyErr))
+	require.Contains(t, verifyErr.Reason, "modified")
+}
+
+func TestAuditKey(t *testing.T) {
+	path := writeAuditFile(t, 2)
+
+	// 没有密钥无法重新计算hash链
+	requireVerifyErrorKey(t, path, []byte("other-key"), 1, "modified")
+	_, err := VerifyAudit(path, nil)
+	require.ErrorIs(t, err, ErrAuditKeyRequired)
+	_, err = NewAuditor(path, nil)
+	require.ErrorIs(t, err, ErrAuditKeyRequired)
+
+	// 改写head使截断不被发现
+	lines := readAuditLines(t, path)
+	writeAuditLines(t, path, lines[:1])
+	require.NoError(t, os.WriteFile(auditHeadPath(path), []byte(`{"seq":1,"hash":"x","mac":"y"}`), 0o600))
+	requireVerifyError(t, path, 1, "head was modified")
+}
+
+func TestAuditHeadLagging(t *testing.T) {
+	// 写入记录后、更新head前退出，重新打开时修复head
+	path := writeAuditFile(t, 2)
+	head, err := os.ReadFile(auditHeadPath(path))
+	require.NoError(t, err)
+
+	auditor, err := NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+	require.NoError(t, auditor.Audit(context.Background(), "user.delete", "user:1", nil))
+	require.NoError(t, auditor.Close())
+	require.NoError(t, os.WriteFile(auditHeadPath(path), head, 0o600))
+	requireVerifyError(t, path, 3, "truncated")
+
+	auditor, err = NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+	require.NoError(t, auditor.Close())
+	count, err := VerifyAudit(path, testAuditKey)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+func TestAuditHeadMissing(t *testing.T) {
+	// 截断到第一行并删除head，不能被当作head落后而修复
+	path := writeAuditFile(t, 3)
+	lines := readAuditLines(t, path)
+	writeAuditLines(t, path, lines[:1])
+	require.NoError(t, os.Remove(auditHeadPath(path)))
+
+	_, err := NewAuditor(path, testAuditKey)
+	var verifyErr *AuditVerifyError
+	require.True(t, errors.As(err, &verifyErr), "unexpected error %v", err)
+	require.Contains(t, verifyErr.Reason, "head file unavailable")
+	requireVerifyError(t, path, 1, "head file unavailable")
+
+	// 新文件写入第一条记录后、更新head前退出，重新打开时修复
+	path = filepath.Join(t.TempDir(), "audit.log")
+	auditor, err := NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+	head, err := os.ReadFile(auditHeadPath(path))
+	require.NoError(t, err)
+	require.NoError(t, auditor.Audit(context.Background(), "login", "user:1", nil))
+	require.NoError(t, auditor.Close())
+	require.NoError(t, os.WriteFile(auditHeadPath(path), head, 0o600))
+
+	auditor, err = NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+	require.NoError(t, auditor.Close())
+	count, err := VerifyAudit(path, testAuditKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestAuditWriteFailure(t *testing.T) {
+	path := writeAuditFile(t, 2)
+	auditor, err := NewAuditor(path, testAuditKey)
+	require.NoError(t, err)
+
+	// 只读的文件写入及截断都会失败，之后拒绝继续写入
+	readOnly, err := os.Open(path)
+	require.NoError(t, err)
+	writable := auditor.file
+	auditor.file = readOnly
+	require.Error(t, auditor.Audit(context.Background(), "user.delete", "user:1", nil))
+	auditor.file = writable
+	require.NoError(t, readOnly.Close())
+	err = auditor.Audit(context.Background(), "user.delete", "user:2", nil)
+	require.ErrorContains(t, err, "partial record")
+	require.NoError(t, auditor.Close())
+
+	count, err := VerifyAudit(path, testAuditKey)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
@@ -0,0 +1,102 @@
+package zlog
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+// callSite 返回调用处的行号，与被测的调用写在同一行
+func callSite() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+func TestCallerPointsToCallSite(t *testing.T) {
+	logs := newTestLogger(t, &Config{AppName: "caller"}).logs
+
+	cases := []struct {
+		name string
+		call func()
+		line int
+	}{
+		{"Debug", func() { Debug("m", nil) }, callSite()},
+		{"DebugO", func() { DebugO("m", 1) }, callSite()},
+		{"Debugf", func() { Debugf("m %d", 1) }, callSite()},
+		{"Info", func() { Info("m", nil) }, callSite()},
+		{"InfoO", func() { InfoO("m", 1) }, callSite()},
+		{"Infof", func() { Infof("m %d", 1) }, callSite()},
+		{"Warn", func() { Warn("m", nil) }, callSite()},
+		{"WarnO", func() { WarnO("m", 1) }, callSite()},
+		{"Warnf", func() { Warnf("m %d", 1) }, callSite()},
+		{"Error", func() { Error("m", nil) }, callSite()},
+		{"ErrorO", func() { ErrorO("m", 1) }, callSite()},
+		{"Errorf", func() { Errorf("m %d", 1) }, callSite()},
+		{"DPanic", func() { DPanic("m", nil) }, callSite()},
+		{"DPanicO", func() { DPanicO("m", 1) }, callSite()},
+		{"DPanicf", func() { DPanicf("m %d", 1) }, callSite()},
+		{"Panic", func() { Panic("m", nil) }, callSite()},
+		{"PanicO", func() { PanicO("m", 1) }, callSite()},
+		{"Panicf", func() { Panicf("m %d", 1) }, callSite()},
+		{"Fatal", func() { Fatal("m", nil) }, callSite()},
+		{"FatalO", func() { FatalO("m", 1) }, callSite()},
+		{"Fatalf", func() { Fatalf("m %d", 1) }, callSite()},
+		{"Logger().Info", func() { Logger().Info("m", nil) }, callSite()},
+		{"Logger().WithContext().Warn", func() { Logger().WithContext(ctx).Warn("m", nil) }, callSite()},
+		{"Logger().WithEvent().Error", func() { Logger().WithEvent("e").Error("m", nil) }, callSite()},
+	}
+
+	for _, c := range cases {
+		logs.TakeAll()
+		func() {
+			defer func() { recover() }() //nolint:errcheck
+			c.call()
+		}()
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1, c.name)
+		caller := entries[0].Caller
+		require.True(t, caller.Defined, c.name)
+		require.Equal(t, "caller_test.go", filepath.Base(caller.File), c.name)
+		require.Equal(t, c.line, caller.Line, c.name)
+	}
+}
+
+func TestCallerSkipAndDisable(t *testing.T) {
+	logs := newTestLogger(t, &Config{CallerSkip: 1}).logs
+	wrapper := func() { Info("m", nil) }
+	wrapper()
+	line := callSite() - 1
+	require.Equal(t, line, logs.TakeAll()[0].Caller.Line)
+
+	logs = newTestLogger(t, &Config{DisableCaller: true}).logs
+	Info("m", nil)
+	require.False(t, logs.TakeAll()[0].Caller.Defined)
+}
+
+func TestDevelopmentMode(t *testing.T) {
+	newTestLogger(t, &Config{})
+	require.NotPanics(t, func() { DPanic("m", nil) })
+
+	newTestLogger(t, &Config{Development: true})
+	require.Panics(t, func() { DPanic("m", nil) })
+}
+
+func TestStacktraceLevel(t *testing.T) {
+	logs := newTestLogger(t, &Config{StacktraceLevel: "error"}).logs
+	Warn("m", nil)
+	Error("m", nil)
+
+	entries := logs.TakeAll()
+	require.Empty(t, entries[0].Stack)
+	require.NotEmpty(t, entries[1].Stack)
+	// 堆栈从调用处开始
+	require.True(t, strings.HasPrefix(entries[1].Stack, "github.com/aixj1984/golibs/zlog.TestStacktraceLevel"), entries[1].Stack)
+
+	logs = newTestLogger(t, &Config{}).logs
+	Error("m", nil)
+	require.Empty(t, logs.TakeAll()[0].Stack)
+}
@@ -13,6 +13,7 @@ import (
 type Entry struct {
 	*zap.Logger
 	fields map[string]interface{}
+	ctx    context.Context
 }
 
 // NewEntry 通过传入zap的logger对象，构造一个entry的对象
@@ -28,6 +29,7 @@ func NewEntry(l *zap.Logger) *Entry {
 // WithContext 通过上下文获取跟踪ID的信息，构造一个实例
 func (e *Entry) WithContext(ctx context.Context) *Entry {
 	newEntry := NewEntry(e.Logger)
+	newEntry.ctx = ctx
 	if traceID := traceIDFromContext(ctx); len(traceID) != 0 {
 		newEntry.fields["trace_id"] = traceID
 	}
@@ -59,20 +61,32 @@ func (e *Entry) WithFields(fields ...zapcore.Field) *Entry {
 	return e
 }
 
-// WithError 向实例中添加err
+// WithError 向实例中添加err，同时展开error链：每一层的错误信息记录在err_causes中，
+// 带调用栈的error（如github.com/pkg/errors）记录在err_stack中，实现了LogFielder的error会添加其提供的字段
 func (e *Entry) WithError(err error) *Entry {
 	if err == nil {
 		return e
 	}
 
+	chain := errorChain(err)
+	for key, val := range errorFields(chain) {
+		e.fields[key] = val
+	}
+
 	e.fields["err"] = err.Error()
+	if causes := errorCauses(chain); len(causes) > 1 {
+		e.fields["err_causes"] = causes
+	}
+	if stack := errorStack(chain); len(stack) > 0 {
+		e.fields["err_stack"] = stack
+	}
 
 	return e
 }
 
 // Fields 获取实例中的所有元素
 func (e *Entry) Fields() []zapcore.Field {
-	fields := make([]zapcore.Field, 0)
+	fields := make([]zapcore.Field, 0, len(e.fields))
 	for key, val := range e.fields {
 		fields = append(fields, zap.Any(key, val))
 	}
@@ -80,39 +94,49 @@ func (e *Entry) Fields() []zapcore.Field {
 	return fields
 }
 
+// logFields 返回输出日志时使用的字段，包括传给core的上下文
+func (e *Entry) logFields() []zapcore.Field {
+	fields := e.Fields()
+	if e.ctx != nil {
+		fields = append(fields, contextField(e.ctx))
+	}
+
+	return fields
+}
+
 // Debug 输出debug级别的日志
 func (e *Entry) Debug(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).Debug(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).Debug(msg, zap.Reflect("content", fields))
 }
 
 // Info 输出info级别的日志
 func (e *Entry) Info(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).Info(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).Info(msg, zap.Reflect("content", fields))
 }
 
 // Warn 输出warn级别的日志
 func (e *Entry) Warn(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).Warn(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).Warn(msg, zap.Reflect("content", fields))
 }
 
 // Error 输出error级别的日志
 func (e *Entry) Error(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).Error(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).Error(msg, zap.Reflect("content", fields))
 }
 
 // DPanic 输出DPanic级别的日志,同时进程退出
 func (e *Entry) DPanic(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).DPanic(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).DPanic(msg, zap.Reflect("content", fields))
 }
 
 // Panic 输出panic级别的日志,同时进程退出
 func (e *Entry) Panic(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).Panic(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).Panic(msg, zap.Reflect("content", fields))
 }
 
 // Fatal 输出fatal级别的日志,同时进程退出
 func (e *Entry) Fatal(msg string, fields interface{}) {
-	e.Logger.With(e.Fields()...).Fatal(msg, zap.Reflect("content", fields))
+	e.Logger.With(e.logFields()...).Fatal(msg, zap.Reflect("content", fields))
 }
 
 /*
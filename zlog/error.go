@@ -0,0 +1,103 @@
+package zlog
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+/* error的日志处理 */
+
+// LogFielder 是可以提供日志字段的error，WithError时会自动将这些字段添加到日志中
+type LogFielder interface {
+	LogFields() Fields
+}
+
+// stackTracer 是github.com/pkg/errors中带调用栈的error
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// errorChain 按从外到内的顺序展开error链，支持Unwrap、errors.Join及pkg/errors的Cause
+func errorChain(err error) []error {
+	chain := make([]error, 0, 4)
+
+	var walk func(err error)
+	walk = func(err error) {
+		for err != nil {
+			chain = append(chain, err)
+
+			switch e := err.(type) { //nolint:errorlint
+			case interface{ Unwrap() []error }:
+				for _, inner := range e.Unwrap() {
+					walk(inner)
+				}
+				return
+			case interface{ Unwrap() error }:
+				err = e.Unwrap()
+			case interface{ Cause() error }:
+				err = e.Cause()
+			default:
+				return
+			}
+		}
+	}
+	walk(err)
+
+	return chain
+}
+
+// errorCauses 返回error链中每一层的错误信息，相邻重复的信息只保留一条
+func errorCauses(chain []error) []string {
+	causes := make([]string, 0, len(chain))
+	for _, err := range chain {
+		msg := err.Error()
+		if len(causes) > 0 && causes[len(causes)-1] == msg {
+			continue
+		}
+		causes = append(causes, msg)
+	}
+
+	return causes
+}
+
+// errorStack 返回error链中最内层的调用栈，即错误最初产生的位置
+func errorStack(chain []error) StackFrames {
+	var tracer stackTracer
+	for _, err := range chain {
+		if st, ok := err.(stackTracer); ok { //nolint:errorlint
+			tracer = st
+		}
+	}
+	if tracer == nil {
+		return nil
+	}
+
+	st := tracer.StackTrace()
+	frames := make(StackFrames, 0, len(st))
+	for _, f := range st {
+		pc := uintptr(f) - 1
+		fn := runtime.FuncForPC(pc)
+		if fn == nil {
+			continue
+		}
+		file, line := fn.FileLine(pc)
+		frames = append(frames, StackFrame{Function: fn.Name(), File: file, Line: line})
+	}
+
+	return frames
+}
+
+// errorFields 汇总error链中LogFielder提供的字段，外层的字段覆盖内层的同名字段
+func errorFields(chain []error) Fields {
+	fields := make(Fields)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if fielder, ok := chain[i].(LogFielder); ok { //nolint:errorlint
+			for key, val := range fielder.LogFields() {
+				fields[key] = val
+			}
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,72 @@
+package zlog
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	require "github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+type orderError struct {
+	orderID int64
+}
+
+func (e *orderError) Error() string { return fmt.Sprintf("order %d not payable", e.orderID) }
+
+func (e *orderError) LogFields() Fields { return Fields{"order_id": e.orderID} }
+
+func newOrderError() error {
+	return errors.WithStack(&orderError{orderID: 42})
+}
+
+func TestWithErrorChain(t *testing.T) {
+	logs := NewTestLogger(t).logs
+
+	err := fmt.Errorf("handle request: %w", errors.Wrap(newOrderError(), "pay"))
+	Logger().WithEvent("pay").WithError(err).Error("pay failed", nil)
+
+	entries := logs.All()
+	require.Len(t, entries, 1)
+	require.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	fields := entries[0].ContextMap()
+
+	require.Equal(t, err.Error(), fields["err"])
+	require.Equal(t, []interface{}{
+		"handle request: pay: order 42 not payable",
+		"pay: order 42 not payable",
+		"order 42 not payable",
+	}, fields["err_causes"])
+	require.EqualValues(t, 42, fields["order_id"])
+
+	// 调用栈取最内层，即错误产生的位置
+	stack, ok := fields["err_stack"].([]interface{})
+	require.True(t, ok)
+	require.NotEmpty(t, stack)
+	require.Contains(t, stack[0].(map[string]interface{})["function"], "newOrderError")
+	require.Equal(t, "pay", fields["event"])
+}
+
+func TestWithErrorPlain(t *testing.T) {
+	logs := NewTestLogger(t).logs
+
+	Logger().WithEvent("plain").WithError(stderrors.New("plain")).Warn("plain error", nil)
+
+	fields := logs.All()[0].ContextMap()
+	require.Equal(t, "plain", fields["err"])
+	require.NotContains(t, fields, "err_causes")
+	require.NotContains(t, fields, "err_stack")
+}
+
+func TestErrorChainJoin(t *testing.T) {
+	first := stderrors.New("first")
+	second := errors.Wrap(&orderError{orderID: 1}, "second")
+	chain := errorChain(stderrors.Join(first, second))
+
+	require.Len(t, chain, 5)
+	require.Equal(t, first, chain[1])
+	require.Equal(t, Fields{"order_id": int64(1)}, errorFields(chain))
+	require.NotEmpty(t, errorStack(chain))
+}
@@ -13,18 +13,28 @@ import (
 
 // Config 是log文件的参数配置
 type Config struct {
-	LogPath    string `mapstructure:"logPath" yaml:"logPath" json:"logPath" comment:"日志文件路径"`
-	AppName    string `mapstructure:"appName" yaml:"appName" json:"appName" comment:"应用名称"`
-	Debug      bool   `mapstructure:"debug" yaml:"debug" json:"debug" comment:"是否开启调试模式"`
-	Level      int8   `mapstructure:"level" yaml:"level" json:"level" comment:"日志级别"`
-	MaxSize    int    `mapstructure:"maxSize" yaml:"maxSize" json:"maxSize" comment:"每个日志文件保存的大小 单位:M"`
-	MaxAge     int    `mapstructure:"maxAge" yaml:"maxAge" json:"maxAge" comment:"文件最多保存多少天"`
-	MaxBackups int    `mapstructure:"maxBackups" yaml:"maxBackups" json:"maxBackups" comment:"日志文件最多保存多少个备份"`
-	Compress   bool   `mapstructure:"compress" yaml:"compress" json:"compress" comment:"是否压缩"`
+	LogPath         string `mapstructure:"logPath" yaml:"logPath" json:"logPath" comment:"日志文件路径"`
+	AppName         string `mapstructure:"appName" yaml:"appName" json:"appName" comment:"应用名称"`
+	Debug           bool   `mapstructure:"debug" yaml:"debug" json:"debug" comment:"是否开启调试模式"`
+	Level           int8   `mapstructure:"level" yaml:"level" json:"level" comment:"日志级别"`
+	MaxSize         int    `mapstructure:"maxSize" yaml:"maxSize" json:"maxSize" comment:"每个日志文件保存的大小 单位:M"`
+	MaxAge          int    `mapstructure:"maxAge" yaml:"maxAge" json:"maxAge" comment:"文件最多保存多少天"`
+	MaxBackups      int    `mapstructure:"maxBackups" yaml:"maxBackups" json:"maxBackups" comment:"日志文件最多保存多少个备份"`
+	Compress        bool   `mapstructure:"compress" yaml:"compress" json:"compress" comment:"是否压缩"`
+	Development     bool   `mapstructure:"development" yaml:"development" json:"development" comment:"是否开启开发模式，DPanic级别的日志会触发panic"`
+	DisableCaller   bool   `mapstructure:"disableCaller" yaml:"disableCaller" json:"disableCaller" comment:"是否关闭文件及行号"`
+	CallerSkip      int    `mapstructure:"callerSkip" yaml:"callerSkip" json:"callerSkip" comment:"额外跳过的调用层数，在zlog之上再做封装时使用"`
+	StacktraceLevel string `mapstructure:"stacktraceLevel" yaml:"stacktraceLevel" json:"stacktraceLevel" comment:"开始输出堆栈的日志级别，如error，为空时不输出"`
+	SpanEvents      bool   `mapstructure:"spanEvents" yaml:"spanEvents" json:"spanEvents" comment:"是否将warn及以上的日志记录为当前span的事件"`
+	AuditPath       string `mapstructure:"auditPath" yaml:"auditPath" json:"auditPath" comment:"审计日志文件路径，为空时不开启"`
+	AuditKey        string `mapstructure:"auditKey" yaml:"auditKey" json:"auditKey" comment:"审计日志hash链的HMAC密钥，开启审计日志时必填"`
 }
 
 var (
-	mLog  *Entry
+	// mLog 是Logger()返回的日志对象，调用位置为Entry方法的调用处
+	mLog *Entry
+	// pLog 是包级别的Debug/Info等函数使用的日志对象，比mLog多跳过一层调用
+	pLog  *Entry
 	mConf *Config
 )
 
@@ -90,23 +100,66 @@ func InitLogger(config *Config) {
 	}
 
 	encoder := zapcore.NewJSONEncoder(encoderConfig)
-	core := zapcore.NewTee(
-		zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(writes...), atomicLevel),
-	)
+	cores := []zapcore.Core{
+		// 与zapcore.NewCore一致，同时统计日志量，见 Stats
+		newCountingCore(encoder, zapcore.NewMultiWriteSyncer(writes...), atomicLevel),
+	}
+	if config.SpanEvents {
+		cores = append(cores, NewSpanEventCore(zapcore.WarnLevel))
+	}
+	core := zapcore.NewTee(cores...)
 
-	// 开启开发模式，堆栈跟踪
-	caller := zap.AddCaller()
-	callerSkip := zap.AddCallerSkip(1)
-	// 开启文件及行号
-	development := zap.Development()
+	setLogger(newZapLogger(core, config))
 
-	// 设置初始化字段
-	field := zap.Fields(zap.String("appName", config.AppName))
+	mConf = config
 
-	// 构造日志
-	mLog = NewEntry(zap.New(core, caller, callerSkip, development, field).WithOptions(zap.AddCallerSkip(1)))
+	if config.AuditPath != "" {
+		if err := InitAudit(config.AuditPath, []byte(config.AuditKey)); err != nil {
+			fmt.Printf("zlog.InitLogger: init audit failed, %s\n", err.Error())
+		}
+	}
+}
 
-	mConf = config
+// newZapLogger 按配置构造zap日志对象，调用位置指向Entry方法的调用处
+func newZapLogger(core zapcore.Core, config *Config, opts ...zap.Option) *zap.Logger {
+	options := []zap.Option{
+		// 跳过Entry的方法这一层
+		zap.AddCallerSkip(1 + config.CallerSkip),
+		// 设置初始化字段
+		zap.Fields(zap.String("appName", config.AppName)),
+	}
+	if !config.DisableCaller {
+		options = append(options, zap.AddCaller())
+	}
+	if config.Development {
+		options = append(options, zap.Development())
+	}
+	if config.StacktraceLevel != "" {
+		level, err := zapcore.ParseLevel(config.StacktraceLevel)
+		if err != nil {
+			fmt.Printf("zlog.InitLogger: invalid stacktraceLevel %q\n", config.StacktraceLevel)
+		} else {
+			options = append(options, zap.AddStacktrace(level))
+		}
+	}
+
+	return zap.New(core, append(options, opts...)...)
+}
+
+// setLogger 设置全局日志对象，包级别的函数比Entry的方法多一层调用
+func setLogger(l *zap.Logger) {
+	mLog = NewEntry(l)
+	pLog = NewEntry(l.WithOptions(zap.AddCallerSkip(1)))
+}
+
+// swapLogger 替换全局日志对象，返回还原的函数
+func swapLogger(l *zap.Logger) (restore func()) {
+	prevM, prevP := mLog, pLog
+	setLogger(l)
+
+	return func() {
+		mLog, pLog = prevM, prevP
+	}
 }
 
 // Empty 是将当前的日志对象设置为null
@@ -127,189 +180,189 @@ func GetConfig() *Config {
 
 // Debug 输出debug级别的日志
 func Debug(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.Debug(msg, fields)
+	pLog.Debug(msg, fields)
 }
 
 // DebugO 输出debug级别的任意对象到日志
 func DebugO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.Debug(msg, object)
+	pLog.Debug(msg, object)
 }
 
 // Debugf 输出debug级别的format日志
 func Debugf(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.Debug("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.Debug("", Fields{"content": fmt.Sprintf(format, args...)})
 }
 
 // Info 输出info级别的日志
 func Info(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.Info(msg, fields)
+	pLog.Info(msg, fields)
 }
 
 // InfoO 输出info级别的任意对象到日志
 func InfoO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.Info(msg, object)
+	pLog.Info(msg, object)
 }
 
 // Infof 输出info级别的format日志
 func Infof(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.Info("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.Info("", Fields{"content": fmt.Sprintf(format, args...)})
 }
 
 // Warn 输出warn级别的日志
 func Warn(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.Warn(msg, fields)
+	pLog.Warn(msg, fields)
 }
 
 // WarnO 输出warn级别的任意对象到日志
 func WarnO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.Warn(msg, object)
+	pLog.Warn(msg, object)
 }
 
 // Warnf 输出warn级别的format日志
 func Warnf(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.Warn("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.Warn("", Fields{"content": fmt.Sprintf(format, args...)})
 }
 
 // Error 输出error级别的日志
 func Error(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.Error(msg, fields)
+	pLog.Error(msg, fields)
 }
 
 // ErrorO 输出error级别的任意对象到日志
 func ErrorO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.Error(msg, object)
+	pLog.Error(msg, object)
 }
 
 // Errorf 输出error级别的format日志
 func Errorf(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.Error("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.Error("", Fields{"content": fmt.Sprintf(format, args...)})
 }
 
 // DPanic 输出dpanic级别的日志,同时进程退出
 func DPanic(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.DPanic(msg, fields)
+	pLog.DPanic(msg, fields)
 }
 
 // DPanicO 输出dpanic级别的任意对象到日志,同时进程退出
 func DPanicO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.DPanic(msg, object)
+	pLog.DPanic(msg, object)
 }
 
 // DPanicf 输出dpanic级别的format日志,同时进程退出
 func DPanicf(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.DPanic("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.DPanic("", Fields{"content": fmt.Sprintf(format, args...)})
 }
 
 // Panic 输出fatal级别的日志,同时进程退出
 func Panic(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.Panic(msg, fields)
+	pLog.Panic(msg, fields)
 }
 
 // PanicO 输出panic级别的任意对象到日志,同时进程退出
 func PanicO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.Panic(msg, object)
+	pLog.Panic(msg, object)
 }
 
 // Panicf 输出panic级别的format日志,同时进程退出
 func Panicf(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.Panic("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.Panic("", Fields{"content": fmt.Sprintf(format, args...)})
 }
 
 // Fatal 输出fatal级别的日志,同时进程退出
 func Fatal(msg string, fields Fields) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, fields)
 		return
 	}
-	mLog.Fatal(msg, fields)
+	pLog.Fatal(msg, fields)
 }
 
 // FatalO 输出fatal级别的任意对象到日志,同时进程退出
 func FatalO(msg string, object interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf("%s : %+v\n", msg, object)
 		return
 	}
-	mLog.Fatal(msg, object)
+	pLog.Fatal(msg, object)
 }
 
 // Fatalf 输出fatal级别的format日志,同时进程退出
 func Fatalf(format string, args ...interface{}) {
-	if mLog == nil {
+	if pLog == nil {
 		fmt.Printf(format+"\n", args...)
 		return
 	}
-	mLog.Fatal("", Fields{"content": fmt.Sprintf(format, args...)})
+	pLog.Fatal("", Fields{"content": fmt.Sprintf(format, args...)})
 }
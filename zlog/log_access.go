@@ -0,0 +1,274 @@
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/* 访问日志的公共配置与处理 */
+
+const (
+	// DefaultRequestIDHeader 是请求ID默认使用的header
+	DefaultRequestIDHeader = "X-Request-ID"
+	// DefaultMaxBodySize 是记录请求体/响应体时默认的最大字节数
+	DefaultMaxBodySize = 4096
+)
+
+// DefaultBodyContentTypes 是默认允许记录body的Content-Type前缀
+var DefaultBodyContentTypes = []string{
+	"application/json",
+	"application/x-www-form-urlencoded",
+	"application/xml",
+	"text/",
+}
+
+// AccessLogConfig 是访问日志中间件的配置
+type AccessLogConfig struct {
+	// LogRequestBody 是否记录请求体
+	LogRequestBody bool
+	// LogResponseBody 是否记录响应体
+	LogResponseBody bool
+	// MaxBodySize 记录body的最大字节数，超出部分截断，<=0 时使用 DefaultMaxBodySize
+	MaxBodySize int
+	// BodyContentTypes 允许记录body的Content-Type前缀，为空时使用 DefaultBodyContentTypes
+	BodyContentTypes []string
+	// Headers 需要记录的请求头
+	Headers []string
+	// RequestIDHeader 请求ID的header，请求中携带时沿用，否则生成新的并写回响应头；为空时使用 DefaultRequestIDHeader
+	RequestIDHeader string
+	// SkipPaths 不记录日志的路径，支持 path.Match 的通配符，如 /static/*
+	SkipPaths []string
+	// StatusLevel 根据响应状态码决定日志级别，为空时使用 DefaultStatusLevel
+	StatusLevel func(status int) zapcore.Level
+	// TrustedProxies 可信代理的IP或CIDR，如 10.0.0.0/8；只有来自可信代理的请求才使用
+	// X-Forwarded-For、X-Real-IP 获取客户端IP，为空时不信任任何代理。gin中间件使用gin自身的配置
+	TrustedProxies []string
+}
+
+// DefaultStatusLevel 是默认的状态码与日志级别的映射：5xx为error，4xx为warn，其余为info
+func DefaultStatusLevel(status int) zapcore.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return zapcore.ErrorLevel
+	case status >= http.StatusBadRequest:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+func (conf *AccessLogConfig) maxBodySize() int {
+	if conf.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+
+	return conf.MaxBodySize
+}
+
+func (conf *AccessLogConfig) requestIDHeader() string {
+	if conf.RequestIDHeader == "" {
+		return DefaultRequestIDHeader
+	}
+
+	return conf.RequestIDHeader
+}
+
+func (conf *AccessLogConfig) level(status int) zapcore.Level {
+	if conf.StatusLevel == nil {
+		return DefaultStatusLevel(status)
+	}
+
+	return conf.StatusLevel(status)
+}
+
+// trustedProxies 解析可信代理，不合法的项返回错误
+func (conf *AccessLogConfig) trustedProxies() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(conf.TrustedProxies))
+	for _, proxy := range conf.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("zlog: invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("zlog: invalid trusted proxy %q: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// skip 判断该路径是否不需要记录
+func (conf *AccessLogConfig) skip(urlPath string) bool {
+	for _, pattern := range conf.SkipPaths {
+		if pattern == urlPath {
+			return true
+		}
+		if ok, err := path.Match(pattern, urlPath); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bodyAllowed 判断该Content-Type的body是否允许记录
+func (conf *AccessLogConfig) bodyAllowed(contentType string) bool {
+	types := conf.BodyContentTypes
+	if len(types) == 0 {
+		types = DefaultBodyContentTypes
+	}
+
+	contentType = strings.ToLower(contentType)
+	for _, t := range types {
+		if strings.HasPrefix(contentType, strings.ToLower(t)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestID 获取请求中的请求ID，没有则生成一个新的
+func (conf *AccessLogConfig) requestID(r *http.Request) string {
+	if id := r.Header.Get(conf.requestIDHeader()); id != "" {
+		return id
+	}
+
+	return uuid.New().String()
+}
+
+// headers 获取需要记录的请求头
+func (conf *AccessLogConfig) headers(r *http.Request) map[string]string {
+	if len(conf.Headers) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(conf.Headers))
+	for _, key := range conf.Headers {
+		if val := r.Header.Get(key); val != "" {
+			headers[key] = val
+		}
+	}
+
+	return headers
+}
+
+// readRequestBody 读取最多limit字节的请求体，并将请求体还原，保证后续的处理可以完整读取
+func readRequestBody(r *http.Request, limit int) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)))
+	r.Body = readCloser{
+		Reader: io.MultiReader(bytes.NewReader(buf), r.Body),
+		Closer: r.Body,
+	}
+	if err != nil {
+		return ""
+	}
+
+	return string(buf)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedBuffer 是只保存前limit字节的buffer
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remain := b.limit - b.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			b.buf.Write(p[:remain])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// accessRecord 是一次请求的访问日志内容，gin与net/http的中间件共用
+type accessRecord struct {
+	status    int
+	method    string
+	path      string
+	route     string
+	query     string
+	ip        string
+	userAgent string
+	requestID string
+	traceID   string
+	headers   map[string]string
+	reqBody   string
+	respBody  string
+	respSize  int
+	errors    string
+	cost      time.Duration
+}
+
+// writeAccessLog 按状态码对应的级别输出访问日志
+func (e *Entry) writeAccessLog(conf *AccessLogConfig, rec *accessRecord) {
+	ce := e.Logger.Check(conf.level(rec.status), rec.path)
+	if ce == nil {
+		return
+	}
+
+	fields := []zapcore.Field{
+		zap.Int("status", rec.status),
+		zap.String("method", rec.method),
+		zap.String("path", rec.path),
+		zap.String("route", rec.route),
+		zap.String("query", rec.query),
+		zap.String("ip", rec.ip),
+		zap.String("user-agent", rec.userAgent),
+		zap.String("request_id", rec.requestID),
+		zap.Int("resp_size", rec.respSize),
+		zap.String("errors", rec.errors),
+		zap.Duration("cost", rec.cost),
+	}
+	if rec.traceID != "" {
+		fields = append(fields, zap.String("trace_id", rec.traceID))
+	}
+	if len(rec.headers) > 0 {
+		fields = append(fields, zap.Any("headers", rec.headers))
+	}
+	if conf.LogRequestBody {
+		fields = append(fields, zap.String("req_body", rec.reqBody))
+	}
+	if conf.LogResponseBody {
+		fields = append(fields, zap.String("resp_body", rec.respBody))
+	}
+
+	ce.Write(fields...)
+}
@@ -1,13 +1,8 @@
 package zlog
 
 import (
-	"errors"
-	"net"
 	"net/http"
 	"net/http/httputil"
-	"os"
-	"runtime/debug"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,77 +13,111 @@ import (
 
 // GinLogger 是给gin框架提供访问日志输出的中间件
 func (e *Entry) GinLogger() gin.HandlerFunc {
+	return e.GinLoggerWithConfig(AccessLogConfig{})
+}
+
+// GinLoggerWithConfig 是按配置输出访问日志的gin中间件，可记录请求体/响应体、指定的请求头、路由模板及请求ID等
+func (e *Entry) GinLoggerWithConfig(conf AccessLogConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if conf.skip(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
 		start := time.Now()
 		path := c.Request.URL.Path
 		query := c.Request.URL.RawQuery
+
+		requestID := conf.requestID(c.Request)
+		c.Set("request_id", requestID)
+		c.Header(conf.requestIDHeader(), requestID)
+
+		var reqBody string
+		if conf.LogRequestBody && conf.bodyAllowed(c.ContentType()) {
+			reqBody = readRequestBody(c.Request, conf.maxBodySize())
+		}
+
+		var respBody *limitedBuffer
+		if conf.LogResponseBody {
+			respBody = &limitedBuffer{limit: conf.maxBodySize()}
+			c.Writer = &ginBodyWriter{ResponseWriter: c.Writer, body: respBody}
+		}
+
 		c.Next()
 
-		cost := time.Since(start)
-
-		e.Logger.Info(path,
-			zap.Int("status", c.Writer.Status()),
-			zap.String("method", c.Request.Method),
-			zap.String("path", path),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
-			zap.String("user-agent", c.Request.UserAgent()),
-			zap.String("errors", c.Errors.ByType(gin.ErrorTypePrivate).String()),
-			zap.Duration("cost", cost),
-		)
+		rec := &accessRecord{
+			status:    c.Writer.Status(),
+			method:    c.Request.Method,
+			path:      path,
+			route:     c.FullPath(),
+			query:     query,
+			ip:        c.ClientIP(),
+			userAgent: c.Request.UserAgent(),
+			requestID: requestID,
+			traceID:   traceIDFromContext(c.Request.Context()),
+			headers:   conf.headers(c.Request),
+			reqBody:   reqBody,
+			respSize:  c.Writer.Size(),
+			errors:    c.Errors.ByType(gin.ErrorTypePrivate).String(),
+			cost:      time.Since(start),
+		}
+		if respBody != nil && conf.bodyAllowed(c.Writer.Header().Get("Content-Type")) {
+			rec.respBody = respBody.String()
+		}
+
+		e.writeAccessLog(&conf, rec)
 	}
 }
 
+// ginBodyWriter 在写响应的同时保存一份响应体
+type ginBodyWriter struct {
+	gin.ResponseWriter
+	body *limitedBuffer
+}
+
+func (w *ginBodyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b) //nolint:errcheck,gosec
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *ginBodyWriter) WriteString(s string) (int, error) {
+	w.body.Write([]byte(s)) //nolint:errcheck,gosec
+
+	return w.ResponseWriter.WriteString(s)
+}
+
 // GinRecovery 是给gin框架提供访异常回复时的日志中间件；错误处理，也可以不写自己处理错误使用gin写好的错误处理
 func (e *Entry) GinRecovery(stack bool) gin.HandlerFunc {
+	return e.GinRecoveryWithConfig(RecoveryConfig{Stack: stack})
+}
+
+// GinRecoveryWithConfig 是按配置处理panic的gin中间件，支持结构化的调用栈、自定义错误响应及告警回调
+func (e *Entry) GinRecoveryWithConfig(conf RecoveryConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				var brokenPipe bool
-
-				if ne, ok := err.(*net.OpError); ok {
-					var se *os.SyscallError
-					if errors.As(ne.Err, &se) {
-						if strings.Contains(strings.ToLower(ne.Err.Error()), "broken pipe") ||
-							strings.Contains(strings.ToLower(ne.Err.Error()), "connection reset by peer") {
-							brokenPipe = true
-						}
-					}
-				}
-
-				httpRequest, httpErr := httputil.DumpRequest(c.Request, false)
-
-				if httpErr != nil {
-					e.Logger.Error("httputil.DumpRequest", zap.Any("error", httpErr))
-				}
-
-				if brokenPipe {
+				if isBrokenPipe(err) {
+					httpRequest, _ := httputil.DumpRequest(c.Request, false)
 					e.Logger.Error(c.Request.URL.Path,
 						zap.Any("error", err),
 						zap.String("request", string(httpRequest)),
 					)
 
-					err := c.Error(err.(error))
-					if err != nil {
-						e.Logger.Error("c.Error", zap.Any("error", httpErr))
-					}
-
+					// 连接已断开，无法再写入响应
+					_ = c.Error(err.(error)) //nolint:errcheck
 					c.Abort()
 
 					return
 				}
 
-				if stack {
-					e.Logger.Error("[Recovery from panic]",
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-						zap.String("stack", string(debug.Stack())),
-					)
-				} else {
-					e.Logger.Error("[Recovery from panic]",
-						zap.Any("error", err),
-						zap.String("request", string(httpRequest)),
-					)
+				report := e.recoverPanic(&conf, c.Request, err)
+
+				if conf.ErrorRender != nil {
+					status, body := conf.ErrorRender(report)
+					c.AbortWithStatusJSON(status, body)
+
+					return
 				}
 
 				c.AbortWithStatus(http.StatusInternalServerError)
@@ -0,0 +1,274 @@
+package zlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/* net/http 的日志处理 */
+
+const httpClientTracerName = "ZLOG-HTTP-CLIENT"
+
+// HTTPMiddleware 是给net/http提供访问日志输出的中间件，字段与GinLogger一致
+func (e *Entry) HTTPMiddleware(next http.Handler) http.Handler {
+	return e.HTTPMiddlewareWithConfig(AccessLogConfig{}, next)
+}
+
+// HTTPMiddlewareWithConfig 是按配置输出访问日志的net/http中间件，配置与GinLoggerWithConfig一致
+// TrustedProxies中有不合法的项时输出错误日志并忽略所有代理
+func (e *Entry) HTTPMiddlewareWithConfig(conf AccessLogConfig, next http.Handler) http.Handler {
+	proxies, err := conf.trustedProxies()
+	if err != nil {
+		e.Logger.Error("http middleware", zap.Error(err))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conf.skip(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		path := r.URL.Path
+		query := r.URL.RawQuery
+
+		requestID := conf.requestID(r)
+		w.Header().Set(conf.requestIDHeader(), requestID)
+
+		var reqBody string
+		if conf.LogRequestBody && conf.bodyAllowed(r.Header.Get("Content-Type")) {
+			reqBody = readRequestBody(r, conf.maxBodySize())
+		}
+
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		if conf.LogResponseBody {
+			rw.body = &limitedBuffer{limit: conf.maxBodySize()}
+		}
+
+		next.ServeHTTP(rw, r)
+
+		rec := &accessRecord{
+			status:    rw.status,
+			method:    r.Method,
+			path:      path,
+			query:     query,
+			ip:        clientIP(r, proxies),
+			userAgent: r.UserAgent(),
+			requestID: requestID,
+			traceID:   traceIDFromContext(r.Context()),
+			headers:   conf.headers(r),
+			reqBody:   reqBody,
+			respSize:  rw.size,
+			cost:      time.Since(start),
+		}
+		if rw.body != nil && conf.bodyAllowed(rw.Header().Get("Content-Type")) {
+			rec.respBody = rw.body.String()
+		}
+
+		e.writeAccessLog(&conf, rec)
+	})
+}
+
+// HTTPRecovery 是给net/http提供panic恢复的日志中间件，记录调用栈并返回500
+func (e *Entry) HTTPRecovery(next http.Handler) http.Handler {
+	return e.HTTPRecoveryWithConfig(RecoveryConfig{Stack: true}, next)
+}
+
+// HTTPRecoveryWithConfig 是按配置处理panic的net/http中间件，配置与GinRecoveryWithConfig一致
+func (e *Entry) HTTPRecoveryWithConfig(conf RecoveryConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+
+			// http.ErrAbortHandler 是主动中断请求，交回给net/http处理
+			if err == http.ErrAbortHandler { //nolint:errorlint
+				panic(err)
+			}
+
+			if isBrokenPipe(err) {
+				e.Logger.Error(r.URL.Path, zap.Any("error", err))
+				return
+			}
+
+			report := e.recoverPanic(&conf, r, err)
+
+			if conf.ErrorRender != nil {
+				status, body := conf.ErrorRender(report)
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(status)
+				if err := json.NewEncoder(w).Encode(body); err != nil {
+					e.Logger.Error("json.Encode", zap.Error(err))
+				}
+
+				return
+			}
+
+			w.WriteHeader(http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseWriter 记录响应的状态码、大小及响应体
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+	body        *limitedBuffer
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if w.body != nil {
+		w.body.Write(b) //nolint:errcheck,gosec
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+
+	return n, err
+}
+
+// Unwrap 供http.ResponseController获取原始的ResponseWriter
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush 实现http.Flusher，原始的ResponseWriter不支持时忽略
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack 实现http.Hijacker，原始的ResponseWriter不支持时返回 http.ErrNotSupported
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("zlog: %T does not implement http.Hijacker: %w", w.ResponseWriter, http.ErrNotSupported)
+	}
+
+	return h.Hijack()
+}
+
+// clientIP 获取客户端IP，来自可信代理的请求从右向左取 X-Forwarded-For 中第一个不是可信代理的IP
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	remote := strings.TrimSpace(r.RemoteAddr)
+	if ip, _, err := net.SplitHostPort(remote); err == nil {
+		remote = ip
+	}
+	if !ipTrusted(remote, proxies) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		parts := strings.Split(forwarded, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(parts[i])
+			if i == 0 || !ipTrusted(ip, proxies) {
+				return ip
+			}
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+
+	return remote
+}
+
+// ipTrusted 判断IP是否为可信代理
+func ipTrusted(addr string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoundTripper 返回一个记录客户端请求日志的http.RoundTripper，同时创建客户端span并向下游传递跟踪信息
+func (e *Entry) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &loggingTransport{entry: e, next: next}
+}
+
+type loggingTransport struct {
+	entry *Entry
+	next  http.RoundTripper
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer(httpClientTracerName).Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	cost := time.Since(start)
+
+	fields := []zapcore.Field{
+		zap.String("method", req.Method),
+		zap.String("url", req.URL.Redacted()),
+		zap.String("host", req.URL.Host),
+		zap.Duration("cost", cost),
+	}
+	if traceID := traceIDFromContext(ctx); traceID != "" {
+		fields = append(fields, zap.String("trace_id", traceID))
+	}
+
+	level := zapcore.ErrorLevel
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fields = append(fields, zap.Error(err))
+	} else {
+		level = DefaultStatusLevel(resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		fields = append(fields, zap.Int("status", resp.StatusCode))
+	}
+
+	if ce := t.entry.Logger.Check(level, "http client "+req.Method); ce != nil {
+		ce.Write(fields...)
+	}
+
+	return resp, err
+}
@@ -0,0 +1,209 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newBufferEntry(buffer *bytes.Buffer) *Entry {
+	return NewEntry(zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buffer),
+		zap.DebugLevel,
+	)))
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	entry := newBufferEntry(buffer)
+
+	handler := entry.HTTPMiddlewareWithConfig(AccessLogConfig{
+		LogRequestBody:  true,
+		LogResponseBody: true,
+		Headers:         []string{"X-Tenant"},
+		SkipPaths:       []string{"/health"},
+		TrustedProxies:  []string{"192.0.2.0/24", "10.0.0.2"},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(body)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "t1")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, `{"id":1}`, w.Body.String())
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	require.Equal(t, "error", line["level"])
+	require.Equal(t, "/orders", line["path"])
+	require.Equal(t, "id=1", line["query"])
+	require.Equal(t, "10.0.0.1", line["ip"])
+	require.Equal(t, w.Header().Get(DefaultRequestIDHeader), line["request_id"])
+	require.Equal(t, `{"id":1}`, line["req_body"])
+	require.Equal(t, `{"id":1}`, line["resp_body"])
+	require.EqualValues(t, 8, line["resp_size"])
+	require.Equal(t, map[string]interface{}{"X-Tenant": "t1"}, line["headers"])
+
+	buffer.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Empty(t, buffer.String())
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := (&AccessLogConfig{TrustedProxies: []string{"192.0.2.1", "10.0.0.0/8"}}).trustedProxies()
+	require.NoError(t, err)
+
+	newReq := func(remote, forwarded string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		return req
+	}
+
+	// 不可信的来源不使用转发的header
+	require.Equal(t, "203.0.113.9", clientIP(newReq("203.0.113.9:1234", "1.1.1.1"), proxies))
+	require.Equal(t, "192.0.2.1", clientIP(newReq("192.0.2.1:1234", "1.1.1.1"), nil))
+	// 伪造的X-Forwarded-For在最左边，取第一个不是可信代理的IP
+	require.Equal(t, "198.51.100.7", clientIP(newReq("192.0.2.1:1234", "1.1.1.1, 198.51.100.7, 10.1.2.3"), proxies))
+	require.Equal(t, "192.0.2.1", clientIP(newReq("192.0.2.1:1234", ""), proxies))
+
+	_, err = (&AccessLogConfig{TrustedProxies: []string{"not-an-ip"}}).trustedProxies()
+	require.Error(t, err)
+}
+
+func TestHTTPMiddlewareFlushHijack(t *testing.T) {
+	entry := newBufferEntry(new(bytes.Buffer))
+
+	var flushed, hijackErr bool
+	handler := entry.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		require.True(t, ok)
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		f.Flush()
+		flushed = true
+
+		h, ok := w.(http.Hijacker)
+		require.True(t, ok)
+		_, _, err := h.Hijack()
+		hijackErr = errors.Is(err, http.ErrNotSupported)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	require.True(t, flushed)
+	require.True(t, w.Flushed)
+	// httptest.ResponseRecorder不支持Hijack
+	require.True(t, hijackErr)
+}
+
+func TestHTTPRecovery(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	entry := newBufferEntry(buffer)
+
+	var reported *PanicReport
+	handler := entry.HTTPRecoveryWithConfig(RecoveryConfig{
+		Stack: true,
+		ErrorRender: func(report *PanicReport) (int, interface{}) {
+			return http.StatusInternalServerError, map[string]string{"msg": report.Value}
+		},
+		OnPanic: func(report *PanicReport) {
+			reported = report
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("http panic")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.JSONEq(t, `{"msg":"http panic"}`, w.Body.String())
+	require.NotNil(t, reported)
+	require.Equal(t, "string", reported.Type)
+	require.Contains(t, reported.Stack[0].Function, "TestHTTPRecovery")
+	require.Contains(t, buffer.String(), "http panic")
+
+	// 默认只返回500
+	w = httptest.NewRecorder()
+	entry.HTTPRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("http panic")
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// http.ErrAbortHandler 交回给net/http处理
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		entry.HTTPRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestRoundTripper(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prev)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	buffer := new(bytes.Buffer)
+	client := &http.Client{Transport: newBufferEntry(buffer).RoundTripper(nil)}
+
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	reqCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/items", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	require.Contains(t, traceparent, traceID.String())
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	require.Equal(t, "warn", line["level"])
+	require.EqualValues(t, http.StatusNotFound, line["status"])
+	require.Equal(t, traceID.String(), line["trace_id"])
+	require.Equal(t, server.URL+"/items", line["url"])
+
+	// 请求失败时输出error日志
+	buffer.Reset()
+	_, err = client.Get("http://127.0.0.1:1/unreachable")
+	require.Error(t, err)
+	require.Contains(t, buffer.String(), `"level":"error"`)
+}
@@ -0,0 +1,212 @@
+package zlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/* panic恢复的公共处理 */
+
+// StackFrame 是解析后的一帧调用栈
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// MarshalLogObject 实现zapcore.ObjectMarshaler，避免反射输出
+func (f StackFrame) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("function", f.Function)
+	enc.AddString("file", f.File)
+	enc.AddInt("line", f.Line)
+
+	return nil
+}
+
+// StackFrames 是调用栈的所有帧
+type StackFrames []StackFrame
+
+// MarshalLogArray 实现zapcore.ArrayMarshaler
+func (fs StackFrames) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, f := range fs {
+		if err := enc.AppendObject(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PanicReport 是一次panic的完整信息，用于日志输出、自定义响应及告警
+type PanicReport struct {
+	Time    time.Time   `json:"time"`
+	Value   string      `json:"value"`
+	Type    string      `json:"type"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Request string      `json:"request"`
+	TraceID string      `json:"trace_id,omitempty"`
+	Stack   StackFrames `json:"stack,omitempty"`
+	// Recovered 是recover()得到的原始值
+	Recovered interface{} `json:"-"`
+}
+
+// RecoveryConfig 是panic恢复中间件的配置
+type RecoveryConfig struct {
+	// Stack 是否解析并记录调用栈
+	Stack bool
+	// ErrorRender 自定义返回给客户端的状态码及JSON内容，为空时只返回500状态码
+	ErrorRender func(report *PanicReport) (status int, body interface{})
+	// OnPanic 发生panic后的回调，可用于告警，如 NewPanicFileReporter
+	OnPanic func(report *PanicReport)
+}
+
+// NewPanicFileReporter 返回一个将PanicReport按JSON行追加写入文件的回调，文件只有所有者可读写
+func NewPanicFileReporter(path string) func(report *PanicReport) {
+	var mu sync.Mutex
+
+	return func(report *PanicReport) {
+		line, err := json.Marshal(report)
+		if err != nil {
+			fmt.Printf("zlog.PanicFileReporter: %s\n", err.Error())
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			fmt.Printf("zlog.PanicFileReporter: %s\n", err.Error())
+			return
+		}
+		defer f.Close() //nolint:errcheck
+		// 之前创建的文件权限可能过宽
+		_ = f.Chmod(0o600) //nolint:errcheck
+
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			fmt.Printf("zlog.PanicFileReporter: %s\n", err.Error())
+		}
+	}
+}
+
+// callerStack 获取panic发生处的调用栈，去掉recover及runtime内部的帧
+func callerStack() StackFrames {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	all := make(StackFrames, 0, n)
+	start := 0
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			start = len(all) + 1
+		}
+		all = append(all, StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			break
+		}
+	}
+
+	// 跳过panic之后runtime内部的帧，如runtime.panicmem、runtime.sigpanic
+	for start < len(all) && strings.HasPrefix(all[start].Function, "runtime.") {
+		start++
+	}
+
+	return all[start:]
+}
+
+// isBrokenPipe 判断是否是客户端断开连接导致的panic，这种情况无需记录调用栈
+func isBrokenPipe(recovered interface{}) bool {
+	ne, ok := recovered.(*net.OpError)
+	if !ok {
+		return false
+	}
+
+	var se *os.SyscallError
+	if errors.As(ne.Err, &se) {
+		msg := strings.ToLower(se.Error())
+		if strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sensitiveHeaders 是panic报告中需要屏蔽的请求头
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Auth-Token"}
+
+// dumpRequest 输出不含body的请求，敏感的请求头被屏蔽
+func dumpRequest(r *http.Request) ([]byte, error) {
+	redacted := *r
+	redacted.Header = r.Header.Clone()
+	for _, key := range sensitiveHeaders {
+		if _, ok := redacted.Header[key]; ok {
+			redacted.Header.Set(key, "******")
+		}
+	}
+
+	return httputil.DumpRequest(&redacted, false)
+}
+
+// recoverPanic 记录panic日志，标记当前span为错误并触发回调，gin与net/http的中间件共用
+func (e *Entry) recoverPanic(conf *RecoveryConfig, r *http.Request, recovered interface{}) *PanicReport {
+	httpRequest, httpErr := dumpRequest(r)
+	if httpErr != nil {
+		e.Logger.Error("httputil.DumpRequest", zap.Any("error", httpErr))
+	}
+
+	report := &PanicReport{
+		Time:      time.Now(),
+		Value:     fmt.Sprint(recovered),
+		Type:      fmt.Sprintf("%T", recovered),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Request:   string(httpRequest),
+		TraceID:   traceIDFromContext(r.Context()),
+		Recovered: recovered,
+	}
+	if conf.Stack {
+		report.Stack = callerStack()
+	}
+
+	if span := trace.SpanFromContext(r.Context()); span.IsRecording() {
+		span.RecordError(fmt.Errorf("panic: %s", report.Value))
+		span.SetStatus(codes.Error, report.Value)
+	}
+
+	fields := []zapcore.Field{
+		zap.Any("error", recovered),
+		zap.String("panic_type", report.Type),
+		zap.String("request", report.Request),
+	}
+	if report.TraceID != "" {
+		fields = append(fields, zap.String("trace_id", report.TraceID))
+	}
+	if conf.Stack {
+		fields = append(fields, zap.Array("stack", report.Stack))
+	}
+	e.Logger.Error("[Recovery from panic]", fields...)
+
+	if conf.OnPanic != nil {
+		conf.OnPanic(report)
+	}
+
+	return report
+}
@@ -3,13 +3,20 @@ package zlog
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -204,3 +211,176 @@ func TestGinRecovery(t *testing.T) {
 	// 检查日志中是否包含了panic的信息
 	require.Contains(t, buffer.String(), "test panic")
 }
+
+func TestGinLoggerWithConfig(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buffer),
+		zap.DebugLevel,
+	))
+
+	router := gin.New()
+	router.Use((&Entry{Logger: logger}).GinLoggerWithConfig(AccessLogConfig{
+		LogRequestBody:  true,
+		LogResponseBody: true,
+		MaxBodySize:     8,
+		Headers:         []string{"X-Tenant"},
+		SkipPaths:       []string{"/health", "/static/*"},
+	}))
+
+	router.POST("/users/:id", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		require.NoError(t, err)
+		c.JSON(http.StatusBadRequest, gin.H{"echo": string(body)})
+	})
+	router.GET("/health", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	router.GET("/static/app.js", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "/users/1?a=b", strings.NewReader(`{"name":"abcdefgh"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "t1")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// 请求体被完整还原给后续的处理函数
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `abcdefgh`)
+	requestID := w.Header().Get(DefaultRequestIDHeader)
+	require.NotEmpty(t, requestID)
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	require.Equal(t, "warn", line["level"])
+	require.Equal(t, "/users/:id", line["route"])
+	require.Equal(t, requestID, line["request_id"])
+	require.Equal(t, `{"name":`, line["req_body"])
+	require.Equal(t, `{"echo":`, line["resp_body"])
+	require.Equal(t, map[string]interface{}{"X-Tenant": "t1"}, line["headers"])
+	require.EqualValues(t, w.Body.Len(), line["resp_size"])
+
+	// 请求中携带的请求ID会被沿用
+	buffer.Reset()
+	req, err = http.NewRequest(http.MethodPost, "/users/2", strings.NewReader("x"))
+	require.NoError(t, err)
+	req.Header.Set(DefaultRequestIDHeader, "req-1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, "req-1", w.Header().Get(DefaultRequestIDHeader))
+	require.Contains(t, buffer.String(), `"request_id":"req-1"`)
+	require.Contains(t, buffer.String(), `"req_body":""`)
+
+	// 跳过的路径不输出日志
+	buffer.Reset()
+	for _, path := range []string{"/health", "/static/app.js"} {
+		req, err = http.NewRequest(http.MethodGet, path, nil)
+		require.NoError(t, err)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	require.Empty(t, buffer.String())
+}
+
+func TestDefaultStatusLevel(t *testing.T) {
+	require.Equal(t, zapcore.InfoLevel, DefaultStatusLevel(http.StatusOK))
+	require.Equal(t, zapcore.InfoLevel, DefaultStatusLevel(http.StatusFound))
+	require.Equal(t, zapcore.WarnLevel, DefaultStatusLevel(http.StatusNotFound))
+	require.Equal(t, zapcore.ErrorLevel, DefaultStatusLevel(http.StatusBadGateway))
+}
+
+// recordingSpan 记录错误状态的span，用于验证panic时span被标记为错误
+type recordingSpan struct {
+	trace.Span
+	code   codes.Code
+	errors []error
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.errors = append(s.errors, err)
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) { s.code = code }
+
+type customPanic struct{ reason string }
+
+func TestGinRecoveryWithConfig(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buffer),
+		zap.InfoLevel,
+	))
+
+	reportFile := filepath.Join(t.TempDir(), "panic.log")
+	span := &recordingSpan{Span: trace.SpanFromContext(context.Background())}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(trace.ContextWithSpan(c.Request.Context(), span))
+		c.Next()
+	})
+	router.Use((&Entry{Logger: logger}).GinRecoveryWithConfig(RecoveryConfig{
+		Stack: true,
+		ErrorRender: func(report *PanicReport) (int, interface{}) {
+			return http.StatusServiceUnavailable, gin.H{"code": 10001, "msg": report.Value}
+		},
+		OnPanic: NewPanicFileReporter(reportFile),
+	}))
+	router.GET("/test", func(c *gin.Context) {
+		panic(&customPanic{reason: "boom"})
+	})
+
+	req, err := http.NewRequest(http.MethodGet, "/test", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Cookie", "session=secret-session")
+	req.Header.Set("X-Tenant", "a001")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// 自定义的错误响应
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.JSONEq(t, `{"code":10001,"msg":"&{boom}"}`, w.Body.String())
+
+	// span被标记为错误
+	require.Equal(t, codes.Error, span.code)
+	require.Len(t, span.errors, 1)
+
+	// 日志中包含panic的类型及解析后的调用栈，第一帧为panic发生的位置
+	var line struct {
+		PanicType string       `json:"panic_type"`
+		Stack     []StackFrame `json:"stack"`
+	}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	require.Equal(t, "*zlog.customPanic", line.PanicType)
+	require.NotEmpty(t, line.Stack)
+	require.Contains(t, line.Stack[0].Function, "TestGinRecoveryWithConfig")
+	require.True(t, strings.HasSuffix(line.Stack[0].File, "log_test.go"))
+
+	// 告警回调写入了panic报告
+	content, err := os.ReadFile(reportFile)
+	require.NoError(t, err)
+	var report PanicReport
+	require.NoError(t, json.Unmarshal(content, &report))
+	require.Equal(t, "/test", report.Path)
+	require.Equal(t, "*zlog.customPanic", report.Type)
+	require.Equal(t, line.Stack, []StackFrame(report.Stack))
+
+	// 敏感的请求头被屏蔽，报告文件只有所有者可读写
+	require.Contains(t, report.Request, "X-Tenant: a001")
+	require.Contains(t, report.Request, "Authorization: ******")
+	require.NotContains(t, report.Request, "secret")
+	require.NotContains(t, buffer.String(), "secret")
+	require.Equal(t, "a001", req.Header.Get("X-Tenant"))
+	require.Equal(t, "Bearer secret-token", req.Header.Get("Authorization"))
+	info, err := os.Stat(reportFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
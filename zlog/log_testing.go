@@ -0,0 +1,158 @@
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+/* 测试用的内存日志 */
+
+// TestingT 是TestLogger用到的 testing.TB 的方法，*testing.T、*testing.B 均已实现；
+// 使用接口而不是 testing.TB，避免引入zlog的业务程序链接testing包
+type TestingT interface {
+	Helper()
+	Cleanup(func())
+	Failed() bool
+	Errorf(format string, args ...interface{})
+	Logf(format string, args ...interface{})
+}
+
+// TestLogger 是测试中使用的日志对象，日志保存在内存中，可对输出的日志进行断言
+type TestLogger struct {
+	*Entry
+	t    TestingT
+	logs *observer.ObservedLogs
+}
+
+// NewTestLogger 创建一个内存日志对象，并在测试期间替换全局日志，
+// 因此被测包中通过 zlog.Info 等接口输出的日志也会被捕获；测试结束时还原全局日志，
+// 只有测试失败时才会打印捕获到的日志。替换的是全局对象，不能用于并行的测试
+func NewTestLogger(t TestingT) *TestLogger {
+	t.Helper()
+
+	return newTestLogger(t, &Config{})
+}
+
+// newTestLogger 按配置构造内存日志并替换全局日志，Fatal级别的日志改为panic，不会结束测试进程
+func newTestLogger(t TestingT, config *Config) *TestLogger {
+	t.Helper()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	restore := swapLogger(newZapLogger(core, config, zap.WithFatalHook(zapcore.WriteThenPanic)))
+	tl := &TestLogger{
+		Entry: mLog,
+		t:     t,
+		logs:  logs,
+	}
+
+	t.Cleanup(func() {
+		restore()
+		if t.Failed() {
+			tl.dump()
+		}
+	})
+
+	return tl
+}
+
+// Entries 返回当前捕获到的所有日志
+func (tl *TestLogger) Entries() []observer.LoggedEntry {
+	return tl.logs.All()
+}
+
+// Reset 清空捕获到的日志
+func (tl *TestLogger) Reset() {
+	tl.logs.TakeAll()
+}
+
+// Logged 判断是否输出过指定级别、消息包含msg且包含所有fields的日志
+func (tl *TestLogger) Logged(level zapcore.Level, msg string, fields Fields) bool {
+	for _, entry := range tl.logs.All() {
+		if entryMatch(entry, level, msg, fields) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AssertLogged 断言输出过指定级别、消息包含msg且包含所有fields的日志。
+// 通过 Infof 等格式化接口输出的日志，msg匹配的是格式化后的内容；
+// fields既匹配 WithField 添加的字段，也匹配 Info 等接口传入的 Fields
+func (tl *TestLogger) AssertLogged(level zapcore.Level, msg string, fields Fields) bool {
+	tl.t.Helper()
+
+	if tl.Logged(level, msg, fields) {
+		return true
+	}
+	tl.t.Errorf("zlog: no %s log matches msg %q with fields %v", level, msg, fields)
+
+	return false
+}
+
+// AssertNotLogged 断言没有输出过指定级别且消息包含msg的日志
+func (tl *TestLogger) AssertNotLogged(level zapcore.Level, msg string) bool {
+	tl.t.Helper()
+
+	if !tl.Logged(level, msg, nil) {
+		return true
+	}
+	tl.t.Errorf("zlog: unexpected %s log matches msg %q", level, msg)
+
+	return false
+}
+
+// dump 将捕获到的日志打印到测试输出
+func (tl *TestLogger) dump() {
+	entries := tl.logs.All()
+	tl.t.Logf("zlog: %d captured log entries", len(entries))
+	for _, entry := range entries {
+		fields, _ := json.Marshal(entry.ContextMap()) //nolint:errchkjson
+		tl.t.Logf("[%s] %s %s %s", entry.Level, entry.Caller.TrimmedPath(), entry.Message, fields)
+	}
+}
+
+// entryMatch 判断一条日志是否匹配
+func entryMatch(entry observer.LoggedEntry, level zapcore.Level, msg string, fields Fields) bool {
+	if entry.Level != level {
+		return false
+	}
+
+	values := entry.ContextMap()
+	content := contentFields(values["content"])
+
+	if msg != "" && !strings.Contains(entry.Message, msg) {
+		if text, ok := content["content"].(string); !ok || !strings.Contains(text, msg) {
+			return false
+		}
+	}
+
+	for key, want := range fields {
+		got, ok := values[key]
+		if !ok {
+			got, ok = content[key]
+		}
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// contentFields 将 Info 等接口传入的内容转为map，非map类型的内容返回nil
+func contentFields(content interface{}) map[string]interface{} {
+	switch val := content.(type) {
+	case Fields:
+		return val
+	case map[string]interface{}:
+		return val
+	default:
+		return nil
+	}
+}
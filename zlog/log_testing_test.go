@@ -0,0 +1,90 @@
+package zlog
+
+import (
+	"fmt"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeTB 记录TestLogger对TestingT的调用
+type fakeTB struct {
+	cleanups []func()
+	failed   bool
+	errors   []string
+	logs     []string
+}
+
+func (tb *fakeTB) Helper()      {}
+func (tb *fakeTB) Failed() bool { return tb.failed }
+
+func (tb *fakeTB) Cleanup(f func()) { tb.cleanups = append(tb.cleanups, f) }
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.failed = true
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Logf(format string, args ...interface{}) {
+	tb.logs = append(tb.logs, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) cleanup() {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+}
+
+func TestNewTestLogger(t *testing.T) {
+	prev := Logger()
+	t.Run("capture", testCapture)
+	// 测试结束后还原全局日志
+	require.Same(t, prev, Logger())
+}
+
+func testCapture(t *testing.T) {
+	tl := NewTestLogger(t)
+	require.Same(t, tl.Entry, Logger())
+
+	Info("create user", Fields{"id": 1, "name": "abc"})
+	Warnf("retry %d times", 3)
+	Logger().WithEvent("login").WithField("user_id", int64(7)).Error("login failed", nil)
+
+	tl.AssertLogged(zapcore.InfoLevel, "create user", Fields{"id": 1})
+	tl.AssertLogged(zapcore.InfoLevel, "create", Fields{"name": "abc"})
+	tl.AssertLogged(zapcore.WarnLevel, "retry 3", nil)
+	tl.AssertLogged(zapcore.ErrorLevel, "login failed", Fields{"event": "login", "user_id": 7})
+	tl.AssertNotLogged(zapcore.ErrorLevel, "create user")
+
+	require.False(t, tl.Logged(zapcore.InfoLevel, "create user", Fields{"id": 2}))
+	require.False(t, tl.Logged(zapcore.InfoLevel, "create user", Fields{"missing": 1}))
+	require.Len(t, tl.Entries(), 3)
+
+	tl.Reset()
+	require.Empty(t, tl.Entries())
+}
+
+func TestLoggerFailure(t *testing.T) {
+	prev := Logger()
+	tb := &fakeTB{}
+	tl := NewTestLogger(tb)
+
+	Info("hello", Fields{"a": 1})
+	require.False(t, tl.AssertLogged(zapcore.ErrorLevel, "hello", nil))
+	require.False(t, tl.AssertNotLogged(zapcore.InfoLevel, "hello"))
+	require.Len(t, tb.errors, 2)
+
+	// 测试失败时打印捕获的日志，并还原全局日志
+	tb.cleanup()
+	require.Same(t, prev, Logger())
+	require.Len(t, tb.logs, 2)
+	require.Contains(t, tb.logs[1], "hello")
+
+	// 测试成功时不打印
+	tb = &fakeTB{}
+	NewTestLogger(tb)
+	Info("quiet", nil)
+	tb.cleanup()
+	require.Empty(t, tb.logs)
+}
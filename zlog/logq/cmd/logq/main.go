@@ -0,0 +1,90 @@
+// Command logq queries the JSON log files written by zlog, including rotated and gzip compressed files.
+//
+//	logq -file ./log/admin-server.log -since 1h -level warn -trace 4bf92f3577b34da6a3ce929d0e0e4736
+//	logq -file ./log/admin-server.log -field user_id=7 -field content.order_id=42 -format json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aixj1984/golibs/zlog/logq"
+)
+
+// fieldFlags 是可重复的 -field key=value 参数
+type fieldFlags map[string]string
+
+func (f fieldFlags) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, val := range f {
+		pairs = append(pairs, key+"="+val)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (f fieldFlags) Set(s string) error {
+	key, val, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("field must be key=value, got %q", s)
+	}
+	f[key] = val
+
+	return nil
+}
+
+// parseTime 支持RFC3339格式的时间，或相对当前时间的时长，如 30m、2h
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func main() {
+	fields := fieldFlags{}
+	file := flag.String("file", "", "log file path, rotated backups next to it are read as well")
+	since := flag.String("since", "", "start time, RFC3339 or duration before now such as 1h")
+	until := flag.String("until", "", "end time, RFC3339 or duration before now such as 10m")
+	level := flag.String("level", "", "minimum level: debug, info, warn, error")
+	traceID := flag.String("trace", "", "trace_id to match")
+	format := flag.String("format", logq.FormatConsole, "output format: console or json")
+	flag.Var(fields, "field", "field equality key=value, can be repeated, nested keys use dots")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	now := time.Now()
+	q := &logq.Query{MinLevel: *level, TraceID: *traceID, Fields: fields}
+
+	var err error
+	if q.Since, err = parseTime(*since, now); err != nil {
+		fmt.Fprintf(os.Stderr, "logq: invalid -since: %s\n", err.Error())
+		os.Exit(2)
+	}
+	if q.Until, err = parseTime(*until, now); err != nil {
+		fmt.Fprintf(os.Stderr, "logq: invalid -until: %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	files, err := logq.Files(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logq: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if _, err := logq.Run(os.Stdout, files, q, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "logq: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
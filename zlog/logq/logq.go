@@ -0,0 +1,347 @@
+// Package logq reads and filters the JSON log files written by zlog.
+package logq
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// FormatJSON 按原始的JSON行输出
+	FormatJSON = "json"
+	// FormatConsole 按便于阅读的控制台格式输出
+	FormatConsole = "console"
+
+	// lumberjack轮转后的文件名中的时间格式
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressSuffix   = ".gz"
+)
+
+// zlog输出日志时使用的字段名
+const (
+	timeKey    = "time"
+	levelKey   = "level"
+	messageKey = "msg"
+	callerKey  = "file"
+	traceKey   = "trace_id"
+)
+
+// 日志中可能出现的时间格式，zlog默认使用ISO8601
+var timeLayouts = []string{
+	"2006-01-02T15:04:05.000Z0700",
+	time.RFC3339Nano,
+}
+
+// Record 是解析后的一条日志
+type Record struct {
+	Time    time.Time
+	Level   zapcore.Level
+	Message string
+	Fields  map[string]interface{}
+	Raw     []byte
+}
+
+// Lookup 获取字段的值，支持用 . 访问嵌套的字段，如 content.user_id
+func (r *Record) Lookup(key string) (interface{}, bool) {
+	if val, ok := r.Fields[key]; ok {
+		return val, true
+	}
+
+	var cur interface{} = r.Fields
+	for _, part := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+
+	return cur, true
+}
+
+// ParseRecord 解析一行JSON日志
+func ParseRecord(line []byte) (*Record, error) {
+	fields := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	record := &Record{Fields: fields, Raw: line}
+	if msg, ok := fields[messageKey].(string); ok {
+		record.Message = msg
+	}
+	if level, ok := fields[levelKey].(string); ok {
+		if lvl, err := zapcore.ParseLevel(level); err == nil {
+			record.Level = lvl
+		}
+	}
+	if ts, ok := fields[timeKey].(string); ok {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, ts); err == nil {
+				record.Time = t
+				break
+			}
+		}
+	}
+
+	return record, nil
+}
+
+// Query 是日志的过滤条件，零值的条件不参与过滤
+type Query struct {
+	// Since 只保留该时间及之后的日志
+	Since time.Time
+	// Until 只保留该时间之前的日志
+	Until time.Time
+	// MinLevel 只保留不低于该级别的日志，如 warn
+	MinLevel string
+	// TraceID 只保留该跟踪ID的日志
+	TraceID string
+	// Fields 只保留字段值相等的日志，key支持 . 访问嵌套的字段
+	Fields map[string]string
+}
+
+// Match 判断日志是否满足过滤条件
+func (q *Query) Match(r *Record) (bool, error) {
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false, nil
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false, nil
+	}
+	if q.MinLevel != "" {
+		level, err := zapcore.ParseLevel(q.MinLevel)
+		if err != nil {
+			return false, err
+		}
+		if r.Level < level {
+			return false, nil
+		}
+	}
+	if q.TraceID != "" {
+		if traceID, _ := r.Fields[traceKey].(string); traceID != q.TraceID {
+			return false, nil
+		}
+	}
+	for key, want := range q.Fields {
+		val, ok := r.Lookup(key)
+		if !ok || formatValue(val) != want {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Files 返回日志文件及lumberjack轮转出的所有备份文件（包括gzip压缩的文件），按时间从早到晚排序
+func Files(path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	filename := filepath.Base(path)
+	ext := filepath.Ext(filename)
+	prefix := strings.TrimSuffix(filename, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		name string
+		time time.Time
+	}
+	backups := make([]backup, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(strings.TrimSuffix(name, compressSuffix), prefix)
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: filepath.Join(dir, name), time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.Before(backups[j].time)
+	})
+
+	files := make([]string, 0, len(backups)+1)
+	for _, b := range backups {
+		files = append(files, b.name)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// Open 打开日志文件，.gz 结尾的文件自动解压
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, compressSuffix) {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close() //nolint:errcheck,gosec
+		return nil, err
+	}
+
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	err := f.Reader.Close()
+	if fileErr := f.file.Close(); err == nil {
+		err = fileErr
+	}
+
+	return err
+}
+
+// Scan 逐行读取日志，对满足条件的日志调用fn，无法解析的行会被忽略
+func Scan(r io.Reader, q *Query, fn func(*Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		record, err := ParseRecord(append([]byte(nil), line...))
+		if err != nil {
+			continue
+		}
+		ok, err := q.Match(record)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Run 按顺序读取所有文件，将满足条件的日志按format输出到w，返回输出的条数
+func Run(w io.Writer, files []string, q *Query, format string) (int, error) {
+	if format != FormatJSON && format != FormatConsole {
+		return 0, fmt.Errorf("logq: unknown format %q", format)
+	}
+
+	count := 0
+	for _, path := range files {
+		r, err := Open(path)
+		if err != nil {
+			return count, err
+		}
+
+		err = Scan(r, q, func(record *Record) error {
+			count++
+			return Write(w, record, format)
+		})
+		r.Close() //nolint:errcheck,gosec
+		if err != nil {
+			return count, fmt.Errorf("logq: %s: %w", path, err)
+		}
+	}
+
+	return count, nil
+}
+
+// Write 按format输出一条日志
+func Write(w io.Writer, r *Record, format string) error {
+	if format == FormatJSON {
+		_, err := fmt.Fprintf(w, "%s\n", r.Raw)
+		return err
+	}
+
+	var sb strings.Builder
+	if r.Time.IsZero() {
+		sb.WriteString("-")
+	} else {
+		sb.WriteString(r.Time.Format("2006-01-02 15:04:05.000"))
+	}
+	fmt.Fprintf(&sb, " %-5s", r.Level.CapitalString())
+	if caller, ok := r.Fields[callerKey].(string); ok {
+		sb.WriteString(" " + caller)
+	}
+	if r.Message != "" {
+		sb.WriteString(" " + r.Message)
+	}
+
+	keys := make([]string, 0, len(r.Fields))
+	for key := range r.Fields {
+		switch key {
+		case timeKey, levelKey, messageKey, callerKey:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(" " + key + "=" + formatValue(r.Fields[key]))
+	}
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// formatValue 将字段的值格式化为字符串，非基础类型输出为JSON
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+
+		return string(b)
+	}
+}
@@ -0,0 +1,124 @@
+package logq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+)
+
+const (
+	oldLines = `{"level":"info","time":"2024-01-01T09:00:00.000+0800","file":"a/a.go:1","msg":"start","appName":"app"}
+{"level":"error","time":"2024-01-01T09:30:00.000+0800","file":"a/a.go:2","msg":"db down","appName":"app","trace_id":"t1"}
+`
+	gzLines = `{"level":"warn","time":"2024-01-02T10:00:00.000+0800","file":"b/b.go:1","msg":"slow","appName":"app","trace_id":"t1","content":{"order_id":42}}
+not a json line
+`
+	currentLines = `{"level":"debug","time":"2024-01-03T08:00:00.000+0800","file":"c/c.go:1","msg":"debug","appName":"app"}
+{"level":"info","time":"2024-01-03T09:00:00.000+0800","file":"c/c.go:2","msg":"user login","appName":"app","user_id":7}
+`
+)
+
+func writeLogFiles(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app-2024-01-01T02-00-00.000.log"), []byte(oldLines), 0o600))
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(gzLines))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app-2024-01-02T03-00-00.000.log.gz"), buf.Bytes(), 0o600))
+
+	require.NoError(t, os.WriteFile(path, []byte(currentLines), 0o600))
+	// 不相关的文件
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.log"), []byte(currentLines), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app-audit.log"), []byte(currentLines), 0o600))
+
+	return path
+}
+
+func TestFiles(t *testing.T) {
+	path := writeLogFiles(t)
+	files, err := Files(path)
+	require.NoError(t, err)
+
+	dir := filepath.Dir(path)
+	require.Equal(t, []string{
+		filepath.Join(dir, "app-2024-01-01T02-00-00.000.log"),
+		filepath.Join(dir, "app-2024-01-02T03-00-00.000.log.gz"),
+		path,
+	}, files)
+}
+
+func runQuery(t *testing.T, q *Query, format string) (int, string) {
+	t.Helper()
+
+	files, err := Files(writeLogFiles(t))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	count, err := Run(&out, files, q, format)
+	require.NoError(t, err)
+
+	return count, out.String()
+}
+
+func TestRunFilters(t *testing.T) {
+	count, _ := runQuery(t, &Query{}, FormatJSON)
+	require.Equal(t, 5, count)
+
+	count, out := runQuery(t, &Query{MinLevel: "warn"}, FormatJSON)
+	require.Equal(t, 2, count)
+	require.Contains(t, out, "db down")
+	require.Contains(t, out, "slow")
+
+	count, _ = runQuery(t, &Query{TraceID: "t1"}, FormatJSON)
+	require.Equal(t, 2, count)
+
+	cst := time.FixedZone("CST", 8*3600)
+	count, out = runQuery(t, &Query{
+		Since: time.Date(2024, 1, 1, 9, 30, 0, 0, cst),
+		Until: time.Date(2024, 1, 3, 9, 0, 0, 0, cst),
+	}, FormatJSON)
+	require.Equal(t, 3, count)
+	require.NotContains(t, out, "user login")
+
+	count, out = runQuery(t, &Query{Fields: map[string]string{"user_id": "7"}}, FormatJSON)
+	require.Equal(t, 1, count)
+	require.Equal(t, strings.Split(currentLines, "\n")[1]+"\n", out)
+
+	count, _ = runQuery(t, &Query{Fields: map[string]string{"content.order_id": "42", "appName": "app"}}, FormatJSON)
+	require.Equal(t, 1, count)
+}
+
+func TestRunConsole(t *testing.T) {
+	count, out := runQuery(t, &Query{Fields: map[string]string{"user_id": "7"}}, FormatConsole)
+	require.Equal(t, 1, count)
+	require.Equal(t, "2024-01-03 09:00:00.000 INFO  c/c.go:2 user login appName=app user_id=7\n", out)
+
+	_, out = runQuery(t, &Query{TraceID: "t1", MinLevel: "warn", Since: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, FormatConsole)
+	require.Contains(t, out, `content={"order_id":42}`)
+}
+
+func TestRunErrors(t *testing.T) {
+	_, err := Run(&bytes.Buffer{}, nil, &Query{}, "xml")
+	require.Error(t, err)
+
+	files, err := Files(writeLogFiles(t))
+	require.NoError(t, err)
+	_, err = Run(&bytes.Buffer{}, files, &Query{MinLevel: "loud"}, FormatJSON)
+	require.Error(t, err)
+
+	_, err = Files(filepath.Join(t.TempDir(), "missing", "app.log"))
+	require.Error(t, err)
+}
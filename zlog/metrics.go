@@ -0,0 +1,215 @@
+package zlog
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+/* 按级别及logger名称统计日志的条数及字节数 */
+
+// defaultLoggerName 是未命名的logger在统计中使用的名称
+const defaultLoggerName = "default"
+
+type statsKey struct {
+	logger string
+	level  zapcore.Level
+}
+
+type statsCounter struct {
+	count atomic.Uint64
+	bytes atomic.Uint64
+}
+
+// logStats 保存所有的计数器，key为statsKey，value为*statsCounter
+var logStats sync.Map
+
+func recordStats(loggerName string, level zapcore.Level, size int) {
+	if loggerName == "" {
+		loggerName = defaultLoggerName
+	}
+
+	key := statsKey{logger: loggerName, level: level}
+	val, ok := logStats.Load(key)
+	if !ok {
+		val, _ = logStats.LoadOrStore(key, &statsCounter{})
+	}
+
+	counter := val.(*statsCounter)
+	counter.count.Add(1)
+	counter.bytes.Add(uint64(size))
+}
+
+// LevelStats 是日志的条数及字节数
+type LevelStats struct {
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
+func (s *LevelStats) add(o LevelStats) {
+	s.Count += o.Count
+	s.Bytes += o.Bytes
+}
+
+// LogStats 是日志量的统计
+type LogStats struct {
+	// Levels 按日志级别统计，key为 debug/info/warn/error 等
+	Levels map[string]LevelStats `json:"levels"`
+	// Loggers 按logger名称统计，未命名的logger为 default
+	Loggers map[string]LevelStats `json:"loggers"`
+	// Total 所有日志的统计
+	Total LevelStats `json:"total"`
+}
+
+// statsEntry 是某个logger某个级别的统计
+type statsEntry struct {
+	statsKey
+	LevelStats
+}
+
+func snapshotStats() []statsEntry {
+	entries := make([]statsEntry, 0)
+	logStats.Range(func(key, val interface{}) bool {
+		counter := val.(*statsCounter)
+		entries = append(entries, statsEntry{
+			statsKey:   key.(statsKey),
+			LevelStats: LevelStats{Count: counter.count.Load(), Bytes: counter.bytes.Load()},
+		})
+
+		return true
+	})
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].logger != entries[j].logger {
+			return entries[i].logger < entries[j].logger
+		}
+
+		return entries[i].level < entries[j].level
+	})
+
+	return entries
+}
+
+// Stats 返回InitLogger初始化的日志自启动以来输出的日志量统计
+func Stats() LogStats {
+	stats := LogStats{
+		Levels:  make(map[string]LevelStats),
+		Loggers: make(map[string]LevelStats),
+	}
+
+	for _, entry := range snapshotStats() {
+		level := stats.Levels[entry.level.String()]
+		level.add(entry.LevelStats)
+		stats.Levels[entry.level.String()] = level
+
+		logger := stats.Loggers[entry.logger]
+		logger.add(entry.LevelStats)
+		stats.Loggers[entry.logger] = logger
+
+		stats.Total.add(entry.LevelStats)
+	}
+
+	return stats
+}
+
+// ResetStats 清空日志量统计
+func ResetStats() {
+	logStats.Range(func(key, _ interface{}) bool {
+		logStats.Delete(key)
+		return true
+	})
+}
+
+// MetricsHandler 返回以Prometheus文本格式输出日志量统计的http.Handler
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		entries := snapshotStats()
+		var sb strings.Builder
+		sb.WriteString("# HELP zlog_entries_total Number of log entries written, by logger and level.\n")
+		sb.WriteString("# TYPE zlog_entries_total counter\n")
+		for _, entry := range entries {
+			fmt.Fprintf(&sb, "zlog_entries_total{logger=\"%s\",level=\"%s\"} %d\n",
+				escapeLabel(entry.logger), entry.level.String(), entry.Count)
+		}
+		sb.WriteString("# HELP zlog_bytes_total Number of encoded log bytes written, by logger and level.\n")
+		sb.WriteString("# TYPE zlog_bytes_total counter\n")
+		for _, entry := range entries {
+			fmt.Fprintf(&sb, "zlog_bytes_total{logger=\"%s\",level=\"%s\"} %d\n",
+				escapeLabel(entry.logger), entry.level.String(), entry.Bytes)
+		}
+
+		_, _ = w.Write([]byte(sb.String())) //nolint:errcheck
+	})
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel 转义Prometheus标签的值
+func escapeLabel(val string) string {
+	return labelReplacer.Replace(val)
+}
+
+// countingCore 与zapcore.NewCore一致，同时统计输出的日志条数及编码后的字节数
+type countingCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out zapcore.WriteSyncer
+}
+
+func newCountingCore(enc zapcore.Encoder, out zapcore.WriteSyncer, enab zapcore.LevelEnabler) zapcore.Core {
+	return &countingCore{LevelEnabler: enab, enc: enc, out: out}
+}
+
+func (c *countingCore) Level() zapcore.Level {
+	return zapcore.LevelOf(c.LevelEnabler)
+}
+
+func (c *countingCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return &countingCore{LevelEnabler: c.LevelEnabler, enc: enc, out: c.out}
+}
+
+func (c *countingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c *countingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	size := buf.Len()
+	_, err = c.out.Write(buf.Bytes())
+	buf.Free()
+
+	recordStats(ent.LoggerName, ent.Level, size)
+	if err != nil {
+		return err
+	}
+
+	if ent.Level > zapcore.ErrorLevel {
+		// 进程可能马上退出，先同步
+		return c.Sync()
+	}
+
+	return nil
+}
+
+func (c *countingCore) Sync() error {
+	return c.out.Sync()
+}
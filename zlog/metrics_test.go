@@ -0,0 +1,70 @@
+package zlog
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newCountingLogger(buffer *bytes.Buffer) *zap.Logger {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	return zap.New(newCountingCore(enc, zapcore.AddSync(buffer), zapcore.InfoLevel))
+}
+
+func TestStats(t *testing.T) {
+	ResetStats()
+	t.Cleanup(ResetStats)
+
+	var buffer bytes.Buffer
+	logger := newCountingLogger(&buffer)
+	logger.Info("a")
+	logger.Info("b", zap.Int("n", 1))
+	logger.Debug("ignored")
+	logger.Named("db").Error("c")
+
+	written := uint64(buffer.Len())
+	stats := Stats()
+	require.Equal(t, uint64(3), stats.Total.Count)
+	require.Equal(t, written, stats.Total.Bytes)
+	require.Equal(t, uint64(2), stats.Levels["info"].Count)
+	require.Equal(t, uint64(1), stats.Levels["error"].Count)
+	require.NotContains(t, stats.Levels, "debug")
+	require.Equal(t, uint64(2), stats.Loggers[defaultLoggerName].Count)
+	require.Equal(t, uint64(1), stats.Loggers["db"].Count)
+	require.Equal(t, written, stats.Loggers[defaultLoggerName].Bytes+stats.Loggers["db"].Bytes)
+
+	// With添加的字段同样会编码输出
+	buffer.Reset()
+	logger.With(zap.String("k", "v")).Info("d")
+	require.Contains(t, buffer.String(), `"k":"v"`)
+	require.Equal(t, written+uint64(buffer.Len()), Stats().Total.Bytes)
+
+	ResetStats()
+	require.Zero(t, Stats().Total.Count)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	ResetStats()
+	t.Cleanup(ResetStats)
+
+	var buffer bytes.Buffer
+	logger := newCountingLogger(&buffer)
+	logger.Warn("a")
+	logger.Named(`q"x`).Info("b")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, 200, rec.Code)
+	require.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+
+	body := rec.Body.String()
+	require.Contains(t, body, "# TYPE zlog_entries_total counter\n")
+	require.Contains(t, body, "zlog_entries_total{logger=\"default\",level=\"warn\"} 1\n")
+	require.Contains(t, body, "zlog_entries_total{logger=\"q\\\"x\",level=\"info\"} 1\n")
+	require.Contains(t, body, "# TYPE zlog_bytes_total counter\n")
+	require.Contains(t, body, "zlog_bytes_total{logger=\"default\",level=\"warn\"} ")
+}
@@ -0,0 +1,489 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+/* OpenTelemetry的日志集成 */
+
+// contextFieldKey 是携带上下文的日志字段，编码时会被忽略，只供span事件及日志导出使用
+const contextFieldKey = "zlog.context"
+
+// contextField 将上下文作为一个不输出的字段，传递给日志core
+func contextField(ctx context.Context) zapcore.Field {
+	return zap.Field{Key: contextFieldKey, Type: zapcore.SkipType, Interface: ctx}
+}
+
+// splitContextField 从字段中取出上下文，并返回其余的字段
+func splitContextField(fields []zapcore.Field) (context.Context, []zapcore.Field) {
+	var ctx context.Context
+	rest := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		if f.Key == contextFieldKey && f.Type == zapcore.SkipType {
+			if c, ok := f.Interface.(context.Context); ok {
+				ctx = c
+			}
+			continue
+		}
+		rest = append(rest, f)
+	}
+
+	return ctx, rest
+}
+
+// AttachCore 为全局日志附加额外的core，如 NewSpanEventCore、NewOTelLogCore
+func AttachCore(cores ...zapcore.Core) {
+	if mLog == nil || len(cores) == 0 {
+		return
+	}
+
+	setLogger(mLog.Logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(append([]zapcore.Core{core}, cores...)...)
+	})))
+}
+
+// contextCore 是需要使用日志上下文的core的公共部分
+type contextCore struct {
+	zapcore.LevelEnabler
+	ctx    context.Context
+	fields []zapcore.Field
+}
+
+func (c contextCore) with(fields []zapcore.Field) contextCore {
+	ctx, rest := splitContextField(fields)
+	if ctx == nil {
+		ctx = c.ctx
+	}
+
+	return contextCore{
+		LevelEnabler: c.LevelEnabler,
+		ctx:          ctx,
+		fields:       append(append(make([]zapcore.Field, 0, len(c.fields)+len(rest)), c.fields...), rest...),
+	}
+}
+
+// entryContext 合并With添加的字段及本次输出的字段，返回日志的上下文及所有字段的值
+func (c contextCore) entryContext(fields []zapcore.Field) (context.Context, map[string]interface{}) {
+	ctx, rest := splitContextField(fields)
+	if ctx == nil {
+		ctx = c.ctx
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range rest {
+		f.AddTo(enc)
+	}
+
+	return ctx, enc.Fields
+}
+
+// spanEventCore 将日志记录为当前span的事件
+type spanEventCore struct {
+	contextCore
+}
+
+// NewSpanEventCore 创建一个将日志记录为上下文中span事件的core，只记录级别不低于level的日志，
+// 需要通过 Logger().WithContext(ctx) 输出日志才能获取到span
+func NewSpanEventCore(level zapcore.LevelEnabler) zapcore.Core {
+	return &spanEventCore{contextCore{LevelEnabler: level}}
+}
+
+func (c *spanEventCore) With(fields []zapcore.Field) zapcore.Core {
+	return &spanEventCore{c.with(fields)}
+}
+
+func (c *spanEventCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+func (c *spanEventCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ctx, values := c.entryContext(fields)
+	if ctx == nil {
+		return nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return nil
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(values)+2)
+	attrs = append(attrs,
+		attribute.String("log.severity", ent.Level.CapitalString()),
+		attribute.String("log.message", ent.Message),
+	)
+	for key, val := range values {
+		attrs = append(attrs, toAttribute(key, val))
+	}
+	span.AddEvent("log", trace.WithAttributes(attrs...), trace.WithTimestamp(ent.Time))
+
+	return nil
+}
+
+func (c *spanEventCore) Sync() error { return nil }
+
+// toAttribute 将日志字段的值转为span属性
+func toAttribute(key string, val interface{}) attribute.KeyValue {
+	switch v := val.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case uint32:
+		return attribute.Int64(key, int64(v))
+	case float64:
+		return attribute.Float64(key, v)
+	case float32:
+		return attribute.Float64(key, float64(v))
+	case time.Duration:
+		return attribute.String(key, v.String())
+	case time.Time:
+		return attribute.String(key, v.Format(time.RFC3339Nano))
+	case fmt.Stringer:
+		return attribute.String(key, v.String())
+	default:
+		if b, err := json.Marshal(v); err == nil {
+			return attribute.String(key, string(b))
+		}
+
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+// LogRecord 是按OpenTelemetry日志数据模型组织的一条日志
+type LogRecord struct {
+	Timestamp         time.Time
+	ObservedTimestamp time.Time
+	SeverityNumber    int
+	SeverityText      string
+	Body              string
+	Attributes        map[string]interface{}
+	TraceID           string
+	SpanID            string
+	// LoggerName 对应OpenTelemetry的InstrumentationScope
+	LoggerName string
+}
+
+// LogExporter 是日志记录的导出接口，可对接OpenTelemetry Collector等后端
+type LogExporter interface {
+	Export(ctx context.Context, records []LogRecord) error
+	Shutdown(ctx context.Context) error
+}
+
+// severityNumber 将zap的日志级别转换为OpenTelemetry的SeverityNumber
+func severityNumber(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 5
+	case zapcore.InfoLevel:
+		return 9
+	case zapcore.WarnLevel:
+		return 13
+	case zapcore.ErrorLevel:
+		return 17
+	case zapcore.DPanicLevel:
+		return 18
+	case zapcore.PanicLevel:
+		return 19
+	case zapcore.FatalLevel:
+		return 21
+	default:
+		return 0
+	}
+}
+
+// OTelBatchConfig 是日志导出的批处理配置
+type OTelBatchConfig struct {
+	// MaxQueueSize 等待导出的最大日志数，队列满时丢弃新的日志，默认2048
+	MaxQueueSize int
+	// MaxBatchSize 每次导出的最大日志数，默认512
+	MaxBatchSize int
+	// BatchTimeout 队列中的日志最长等待多久导出，默认1s
+	BatchTimeout time.Duration
+	// ExportTimeout 每次导出的超时时间，默认30s
+	ExportTimeout time.Duration
+}
+
+func (conf OTelBatchConfig) withDefaults() OTelBatchConfig {
+	if conf.MaxQueueSize <= 0 {
+		conf.MaxQueueSize = 2048
+	}
+	if conf.MaxBatchSize <= 0 {
+		conf.MaxBatchSize = 512
+	}
+	if conf.MaxBatchSize > conf.MaxQueueSize {
+		conf.MaxBatchSize = conf.MaxQueueSize
+	}
+	if conf.BatchTimeout <= 0 {
+		conf.BatchTimeout = time.Second
+	}
+	if conf.ExportTimeout <= 0 {
+		conf.ExportTimeout = 30 * time.Second
+	}
+
+	return conf
+}
+
+// OTelLogCore 将日志转为LogRecord，在后台批量通过exporter导出，
+// Sync 导出队列中的日志，程序退出前需调用 Shutdown
+type OTelLogCore struct {
+	contextCore
+	batcher *logBatcher
+}
+
+// NewOTelLogCore 创建一个将日志导出为OpenTelemetry日志记录的core，只导出级别不低于level的日志，使用默认的批处理配置
+func NewOTelLogCore(exporter LogExporter, level zapcore.LevelEnabler) *OTelLogCore {
+	return NewOTelLogCoreWithConfig(exporter, level, OTelBatchConfig{})
+}
+
+// NewOTelLogCoreWithConfig 创建一个按配置批量导出日志的core
+func NewOTelLogCoreWithConfig(exporter LogExporter, level zapcore.LevelEnabler, conf OTelBatchConfig) *OTelLogCore {
+	return &OTelLogCore{
+		contextCore: contextCore{LevelEnabler: level},
+		batcher:     newLogBatcher(exporter, conf.withDefaults()),
+	}
+}
+
+// With 实现zapcore.Core
+func (c *OTelLogCore) With(fields []zapcore.Field) zapcore.Core {
+	return &OTelLogCore{contextCore: c.with(fields), batcher: c.batcher}
+}
+
+// Check 实现zapcore.Core
+func (c *OTelLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+
+	return ce
+}
+
+// Write 实现zapcore.Core，日志放入队列后立即返回
+func (c *OTelLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ctx, values := c.entryContext(fields)
+
+	record := LogRecord{
+		Timestamp:         ent.Time,
+		ObservedTimestamp: time.Now(),
+		SeverityNumber:    severityNumber(ent.Level),
+		SeverityText:      ent.Level.CapitalString(),
+		Body:              ent.Message,
+		Attributes:        values,
+		LoggerName:        ent.LoggerName,
+	}
+	if ent.Caller.Defined {
+		record.Attributes["code.filepath"] = ent.Caller.File
+		record.Attributes["code.lineno"] = ent.Caller.Line
+	}
+	if ctx != nil {
+		if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+			record.TraceID = spanCtx.TraceID().String()
+			record.SpanID = spanCtx.SpanID().String()
+		}
+	}
+	c.batcher.enqueue(record)
+
+	return nil
+}
+
+// Sync 实现zapcore.Core，导出队列中的所有日志
+func (c *OTelLogCore) Sync() error {
+	return c.batcher.flush()
+}
+
+// Shutdown 导出队列中的日志并关闭exporter，之后的日志被丢弃
+func (c *OTelLogCore) Shutdown(ctx context.Context) error {
+	return c.batcher.shutdown(ctx)
+}
+
+// Dropped 返回因队列已满或已关闭而丢弃的日志数
+func (c *OTelLogCore) Dropped() int64 {
+	return c.batcher.dropped.Load()
+}
+
+// logBatcher 在后台批量导出日志
+type logBatcher struct {
+	exporter LogExporter
+	conf     OTelBatchConfig
+	queue    chan LogRecord
+	flushReq chan chan error
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	dropped  atomic.Int64
+}
+
+func newLogBatcher(exporter LogExporter, conf OTelBatchConfig) *logBatcher {
+	b := &logBatcher{
+		exporter: exporter,
+		conf:     conf,
+		queue:    make(chan LogRecord, conf.MaxQueueSize),
+		flushReq: make(chan chan error),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+
+	return b
+}
+
+// enqueue 将日志放入队列，队列已满或已关闭时丢弃
+func (b *logBatcher) enqueue(record LogRecord) {
+	select {
+	case <-b.stop:
+		b.dropped.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case b.queue <- record:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+func (b *logBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.conf.BatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]LogRecord, 0, b.conf.MaxBatchSize)
+	// export 导出当前的批次，exporter可能持有切片，导出后使用新的切片
+	export := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.conf.ExportTimeout)
+		defer cancel()
+		err := b.exporter.Export(ctx, batch)
+		batch = make([]LogRecord, 0, b.conf.MaxBatchSize)
+		if err != nil {
+			// 导出失败不能再输出到日志，避免循环
+			fmt.Fprintf(os.Stderr, "zlog: otel log export failed: %v\n", err)
+		}
+
+		return err
+	}
+	// drain 导出队列中已有的日志
+	drain := func() error {
+		var errs []error
+		for {
+			select {
+			case record := <-b.queue:
+				batch = append(batch, record)
+				if len(batch) >= b.conf.MaxBatchSize {
+					errs = append(errs, export())
+				}
+			default:
+				return errors.Join(append(errs, export())...)
+			}
+		}
+	}
+
+	for {
+		select {
+		case record := <-b.queue:
+			batch = append(batch, record)
+			if len(batch) >= b.conf.MaxBatchSize {
+				_ = export() //nolint:errcheck
+			}
+		case <-ticker.C:
+			_ = export() //nolint:errcheck
+		case reply := <-b.flushReq:
+			reply <- drain()
+		case <-b.stop:
+			_ = drain() //nolint:errcheck
+			return
+		}
+	}
+}
+
+// flush 等待队列中的日志导出完成
+func (b *logBatcher) flush() error {
+	reply := make(chan error, 1)
+	select {
+	case b.flushReq <- reply:
+		return <-reply
+	case <-b.done:
+		return nil
+	}
+}
+
+func (b *logBatcher) shutdown(ctx context.Context) error {
+	b.stopOnce.Do(func() { close(b.stop) })
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return b.exporter.Shutdown(ctx)
+}
+
+// InMemoryExporter 是保存在内存中的LogExporter，用于测试
+type InMemoryExporter struct {
+	mu      sync.Mutex
+	records []LogRecord
+}
+
+// NewInMemoryExporter 创建一个内存中的LogExporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export 实现LogExporter
+func (e *InMemoryExporter) Export(_ context.Context, records []LogRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records = append(e.records, records...)
+
+	return nil
+}
+
+// Shutdown 实现LogExporter
+func (e *InMemoryExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// Records 返回已导出的所有日志记录
+func (e *InMemoryExporter) Records() []LogRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]LogRecord(nil), e.records...)
+}
+
+// Reset 清空已导出的日志记录
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records = nil
+}
@@ -0,0 +1,186 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type spanEvent struct {
+	name  string
+	attrs map[attribute.Key]attribute.Value
+}
+
+// eventSpan 记录事件的span
+type eventSpan struct {
+	trace.Span
+	sc     trace.SpanContext
+	events []spanEvent
+}
+
+func (s *eventSpan) IsRecording() bool              { return true }
+func (s *eventSpan) SpanContext() trace.SpanContext { return s.sc }
+func (s *eventSpan) AddEvent(name string, opts ...trace.EventOption) {
+	cfg := trace.NewEventConfig(opts...)
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range cfg.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	s.events = append(s.events, spanEvent{name: name, attrs: attrs})
+}
+
+func newEventSpanContext() (context.Context, *eventSpan) {
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	span := &eventSpan{
+		Span: trace.SpanFromContext(context.Background()),
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+	}
+
+	return trace.ContextWithSpan(context.Background(), span), span
+}
+
+func TestSpanEventCore(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	entry := NewEntry(zap.New(zapcore.NewTee(
+		zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buffer), zap.DebugLevel),
+		NewSpanEventCore(zapcore.WarnLevel),
+	)))
+
+	spanCtx, span := newEventSpanContext()
+
+	entry.WithContext(spanCtx).Info("info is not recorded", nil)
+	entry.WithContext(spanCtx).WithField("order_id", 1).Warn("slow order", Fields{"cost": 3})
+	entry.WithEvent("no context").Error("without span", nil)
+
+	require.Len(t, span.events, 1)
+	event := span.events[0]
+	require.Equal(t, "log", event.name)
+	require.Equal(t, "WARN", event.attrs["log.severity"].AsString())
+	require.Equal(t, "slow order", event.attrs["log.message"].AsString())
+	require.Equal(t, int64(1), event.attrs["order_id"].AsInt64())
+	require.Equal(t, `{"cost":3}`, event.attrs["content"].AsString())
+	require.Equal(t, span.sc.TraceID().String(), event.attrs["trace_id"].AsString())
+
+	// 上下文字段不会输出到日志文件中
+	require.NotContains(t, buffer.String(), contextFieldKey)
+	require.Contains(t, buffer.String(), "slow order")
+}
+
+func TestOTelLogCore(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	core := NewOTelLogCore(exporter, zapcore.InfoLevel)
+	entry := NewEntry(zap.New(core, zap.AddCaller()).Named("order"))
+
+	spanCtx, span := newEventSpanContext()
+	entry.Debug("debug is not exported", nil)
+	entry.WithContext(spanCtx).WithField("order_id", 2).Error("pay failed", nil)
+	require.NoError(t, entry.Logger.Sync())
+
+	records := exporter.Records()
+	require.Len(t, records, 1)
+	record := records[0]
+	require.Equal(t, "pay failed", record.Body)
+	require.Equal(t, 17, record.SeverityNumber)
+	require.Equal(t, "ERROR", record.SeverityText)
+	require.Equal(t, "order", record.LoggerName)
+	require.Equal(t, span.sc.TraceID().String(), record.TraceID)
+	require.Equal(t, span.sc.SpanID().String(), record.SpanID)
+	require.EqualValues(t, 2, record.Attributes["order_id"])
+	require.Contains(t, record.Attributes, "code.filepath")
+
+	exporter.Reset()
+	require.Empty(t, exporter.Records())
+	require.NoError(t, core.Shutdown(context.Background()))
+
+	// 关闭后的日志被丢弃
+	entry.Error("after shutdown", nil)
+	require.NoError(t, entry.Logger.Sync())
+	require.Empty(t, exporter.Records())
+	require.EqualValues(t, 1, core.Dropped())
+}
+
+// blockingExporter 在release关闭前阻塞导出
+type blockingExporter struct {
+	InMemoryExporter
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (e *blockingExporter) Export(ctx context.Context, records []LogRecord) error {
+	e.once.Do(func() { close(e.started) })
+	<-e.release
+
+	return e.InMemoryExporter.Export(ctx, records)
+}
+
+func TestOTelLogCoreBatch(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	core := NewOTelLogCoreWithConfig(exporter, zapcore.InfoLevel, OTelBatchConfig{MaxBatchSize: 2, BatchTimeout: time.Hour})
+	entry := NewEntry(zap.New(core))
+
+	// 达到MaxBatchSize时导出，不足一批的在Sync时导出
+	for i := 0; i < 5; i++ {
+		entry.Info("batch", Fields{"i": i})
+	}
+	require.Eventually(t, func() bool { return len(exporter.Records()) == 4 }, time.Second, time.Millisecond)
+	require.NoError(t, core.Sync())
+	require.Len(t, exporter.Records(), 5)
+
+	// 导出阻塞时写日志不阻塞，队列满后丢弃
+	blocking := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	core = NewOTelLogCoreWithConfig(blocking, zapcore.InfoLevel, OTelBatchConfig{MaxQueueSize: 1, MaxBatchSize: 1})
+	entry = NewEntry(zap.New(core))
+	entry.Info("exporting", nil)
+	<-blocking.started
+	entry.Info("queued", nil)
+	entry.Info("dropped", nil)
+	require.EqualValues(t, 1, core.Dropped())
+
+	close(blocking.release)
+	require.NoError(t, core.Shutdown(context.Background()))
+	records := blocking.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, "queued", records[1].Body)
+}
+
+func TestEntryFieldsWithoutContext(t *testing.T) {
+	spanCtx, _ := newEventSpanContext()
+	fields := Logger().WithContext(spanCtx).WithField("a", 1).Fields()
+	for _, f := range fields {
+		require.NotEqual(t, contextFieldKey, f.Key)
+	}
+}
+
+func TestAttachCore(t *testing.T) {
+	logs := NewTestLogger(t).logs
+	exporter := NewInMemoryExporter()
+	core := NewOTelLogCore(exporter, zapcore.WarnLevel)
+	defer core.Shutdown(context.Background()) //nolint:errcheck
+	AttachCore(core)
+
+	Info("not exported", nil)
+	Warn("exported", Fields{"a": 1})
+	require.NoError(t, core.Sync())
+
+	records := exporter.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, "exported", records[0].Body)
+	require.Equal(t, 13, records[0].SeverityNumber)
+
+	// 原有的core仍然输出
+	require.Equal(t, 2, logs.Len())
+}